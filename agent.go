@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// agentRequest is a scenario fragment coordinator pushes to an agent.
+type agentRequest struct {
+	Scenario  Scenario  `json:"scenario"`
+	Role      string    `json:"role"`
+	Precision int       `json:"precision"`
+	StartAt   time.Time `json:"start_at"` // All agents of a run start together.
+	// ClockOffset is agent clock minus coordinator clock,
+	// envelope timestamps are written in coordinator time.
+	ClockOffset duration `json:"clock_offset"`
+}
+
+// agentEvent is a line of agent response stream: an empty event when the
+// run is accepted, progress updates and the result or the error of the run.
+type agentEvent struct {
+	Progress *Progress `json:"progress,omitempty"`
+	Result   *Result   `json:"result,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// agent runs scenario fragments pushed by coordinator, one at a time.
+type agent struct {
+	mu sync.Mutex // Held while a run goes.
+}
+
+// runAgent implements "agent" command.
+func runAgent(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("agent", flag.ExitOnError)
+	listen := fs.String("listen", ":7070", "address to listen for coordinator on")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s agent [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	a := &agent{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/run", a.run)
+	mux.HandleFunc("/clock", a.clock)
+	srv := &http.Server{Addr: *listen, Handler: mux, BaseContext: func(_ net.Listener) context.Context { return ctx }}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+
+	log.Printf("Agent listening on %s", *listen)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("Agent failed: %v", err)
+	}
+}
+
+// run handles POST /run: validates the fragment, waits for the start time,
+// runs it and streams progress and the result back as JSON lines.
+// The run is canceled if coordinator goes away.
+func (a *agent) run(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST a run request", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.mu.TryLock() {
+		http.Error(w, "agent is busy with another run", http.StatusConflict)
+		return
+	}
+	defer a.mu.Unlock()
+
+	var req agentRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid run request: %v", err), http.StatusBadRequest)
+		return
+	}
+	cfg, err := req.config()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	startAt := req.StartAt.Add(cfg.ClockOffset) // Local time.
+	if time.Now().After(startAt) {
+		// Starting late would break the synchronized start.
+		http.Error(w, fmt.Sprintf("start time %v has already passed (start delay too short or clocks are not in sync)", req.StartAt.Format(time.RFC3339Nano)), http.StatusBadRequest)
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	var mu sync.Mutex // Serializes events, progress comes from another goroutine.
+	done := false     // No writes after the handler returns.
+	defer func() {
+		mu.Lock()
+		done = true
+		mu.Unlock()
+	}()
+	enc := json.NewEncoder(w)
+	send := func(e agentEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		if done {
+			return
+		}
+		if err := enc.Encode(e); err != nil {
+			log.Printf("Failed to send event to coordinator: %v", err)
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	send(agentEvent{}) // Accepted.
+
+	ctx := r.Context()
+	log.Printf("Run accepted (%s role), starting at %v", req.Role, req.StartAt.Format(time.RFC3339Nano))
+	select {
+	case <-ctx.Done():
+		log.Printf("Run canceled by coordinator before start")
+		return
+	case <-time.After(time.Until(startAt)):
+	}
+
+	cfg.Progress = func(p Progress) { send(agentEvent{Progress: &p}) }
+	res, err := RunBench(ctx, cfg)
+	if ctx.Err() != nil {
+		log.Printf("Run canceled by coordinator")
+		return
+	}
+	if err != nil {
+		// Agent keeps serving, the coordinator fails the run.
+		log.Printf("Run failed: %v", err)
+		send(agentEvent{Error: err.Error()})
+		return
+	}
+	send(agentEvent{Result: &res})
+}
+
+// config validates request and returns its run configuration.
+func (req agentRequest) config() (Config, error) {
+	s := req.Scenario
+	if err := s.resolve(); err != nil {
+		return Config{}, fmt.Errorf("invalid scenario: %w", err)
+	}
+	switch req.Role {
+	case roleBoth, roleProduce, roleConsume:
+	default:
+		return Config{}, fmt.Errorf("unknown role %q (want both, produce or consume)", req.Role)
+	}
+	if req.Precision < 1 || req.Precision > maxPrecision {
+		return Config{}, fmt.Errorf("histogram precision must be in 1..%d range, got %d", maxPrecision, req.Precision)
+	}
+
+	cfg := s.config()
+	cfg.Role = req.Role
+	cfg.Precision = req.Precision
+	cfg.ClockOffset = time.Duration(req.ClockOffset)
+	return cfg, nil
+}
+
+// postRun pushes run request to agent and calls event for every event
+// it streams back until the result or the error of the run arrives.
+func postRun(ctx context.Context, url string, req agentRequest, event func(agentEvent)) (Result, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return Result{}, err
+	}
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, url+"/run", bytes.NewReader(body))
+	if err != nil {
+		return Result{}, err
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(hreq)
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return Result{}, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var e agentEvent
+		if err := dec.Decode(&e); err != nil {
+			if ctx.Err() != nil {
+				return Result{}, ctx.Err()
+			}
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return Result{}, fmt.Errorf("connection lost before the run finished: %w", err)
+		}
+		if e.Result != nil {
+			return *e.Result, nil
+		}
+		if e.Error != "" {
+			return Result{}, errors.New(e.Error)
+		}
+		event(e)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Assertion references, see assertion.
+const (
+	refTarget   = "target"   // Scenario target rate.
+	refBaseline = "baseline" // The same metric of baseline result.
+)
+
+// assertion is a check of run result, "METRIC OP VALUE" like "p99 < 15ms",
+// "missing == 0" or "error_rate < 0.1%". VALUE can also be a share of
+// scenario target rate or of baseline result: "throughput >= 95% target",
+// "p99 <= 110% baseline".
+type assertion struct {
+	text   string
+	metric string
+	op     string
+	value  float64 // Limit, or share of the reference.
+	ref    string  // Empty, refTarget or refBaseline.
+}
+
+// AssertionResult is an assertion evaluated against run result.
+type AssertionResult struct {
+	Assertion string  `json:"assertion"`
+	Actual    float64 `json:"actual"`
+	Limit     float64 `json:"limit"`
+	Unit      string  `json:"unit"`
+	Passed    bool    `json:"passed"`
+	Error     string  `json:"error,omitempty"` // Why it couldn't be evaluated, such assertion fails.
+}
+
+// metric is a value of result assertions can check.
+type metric struct {
+	unit  string // ms, msg/s, MiB/s, messages or ratio.
+	value func(Result) float64
+}
+
+// latencyKinds are prefixes of latency metrics, "" for end-to-end latency.
+var latencyKinds = map[string]func(LatencyPercentiles) Percentiles{
+	"":           func(l LatencyPercentiles) Percentiles { return l.Latency },
+	"corrected_": func(l LatencyPercentiles) Percentiles { return l.Corrected },
+	"ack_":       func(l LatencyPercentiles) Percentiles { return l.Ack },
+	"append_":    func(l LatencyPercentiles) Percentiles { return l.Append },
+	"delivery_":  func(l LatencyPercentiles) Percentiles { return l.Delivery },
+}
+
+var latencyStats = map[string]func(Percentiles) float64{
+	"p50":   func(p Percentiles) float64 { return p.P50 },
+	"p90":   func(p Percentiles) float64 { return p.P90 },
+	"p99":   func(p Percentiles) float64 { return p.P99 },
+	"p99.9": func(p Percentiles) float64 { return p.P999 },
+	"max":   func(p Percentiles) float64 { return p.Max },
+	"mean":  func(p Percentiles) float64 { return p.Mean },
+}
+
+var counterMetrics = map[string]metric{
+	// Throughput is of the measurement window when time series tells it.
+	"throughput": {"msg/s", func(r Result) float64 {
+		if r.MeasuredThroughput != nil {
+			return r.MeasuredThroughput.Mean
+		}
+		return r.Throughput
+	}},
+	"produce_throughput": {"msg/s", func(r Result) float64 { return r.ProduceThroughput }},
+	"data_throughput":    {"MiB/s", func(r Result) float64 { return r.DataThroughput }},
+	"missing":            {"messages", func(r Result) float64 { return float64(r.Errors.Missing) }},
+	// Messages sent before consumers were ready are most likely lost at the head of a stream.
+	"missing_after_head": {"messages", func(r Result) float64 { return float64(r.Errors.Missing - r.Errors.HeadMissing) }},
+	"duplicated":         {"messages", func(r Result) float64 { return float64(r.Errors.Duplicated) }},
+	"produce_failed":     {"messages", func(r Result) float64 { return float64(r.Errors.ProduceFailed) }},
+	"gaps":               {"messages", func(r Result) float64 { return float64(r.Errors.Gaps) }},
+	"reordered":          {"messages", func(r Result) float64 { return float64(r.Errors.Reordered) }},
+	"drain_timeouts":     {"topics", func(r Result) float64 { return float64(r.Errors.DrainTimeouts) }},
+	// Error rate is failed produce calls and lost messages per produce call.
+	"error_rate": {"ratio", func(r Result) float64 {
+		calls := float64(r.Produced) + float64(r.Errors.ProduceFailed)
+		if calls == 0 {
+			return 0
+		}
+		return float64(r.Errors.ProduceFailed+r.Errors.Missing) / calls
+	}},
+}
+
+// lookupMetric returns metric by name, latencies are "[KIND_]STAT" like "p99" or "ack_max".
+func lookupMetric(name string) (metric, bool) {
+	if m, ok := counterMetrics[name]; ok {
+		return m, true
+	}
+	for prefix, kind := range latencyKinds {
+		if stat, ok := latencyStats[strings.TrimPrefix(name, prefix)]; ok && strings.HasPrefix(name, prefix) {
+			kind := kind
+			return metric{unit: "ms", value: func(r Result) float64 { return stat(kind(r.Percentiles)) }}, true
+		}
+	}
+	return metric{}, false
+}
+
+func parseAssertion(s string) (assertion, error) {
+	a := assertion{text: s}
+	fields := strings.Fields(s)
+	if len(fields) != 3 && len(fields) != 4 {
+		return a, fmt.Errorf("%q: want METRIC OP VALUE, like \"p99 < 15ms\" or \"throughput >= 95%% target\"", s)
+	}
+	a.metric, a.op = fields[0], fields[1]
+	m, ok := lookupMetric(a.metric)
+	if !ok {
+		return a, fmt.Errorf("%q: unknown metric %s", s, a.metric)
+	}
+	switch a.op {
+	case "<", "<=", ">", ">=", "==":
+	default:
+		return a, fmt.Errorf("%q: unknown operator %s (want <, <=, >, >= or ==)", s, a.op)
+	}
+
+	v := fields[2]
+	percent := strings.HasSuffix(v, "%")
+	if len(fields) == 4 {
+		a.ref = fields[3]
+		if a.ref != refTarget && a.ref != refBaseline {
+			return a, fmt.Errorf("%q: unknown reference %s (want target or baseline)", s, a.ref)
+		}
+		if a.ref == refTarget && m.unit != "msg/s" {
+			return a, fmt.Errorf("%q: only throughput can be compared to target rate", s)
+		}
+		if !percent {
+			return a, fmt.Errorf("%q: share of %s must be a percentage", s, a.ref)
+		}
+	}
+
+	var err error
+	switch {
+	case percent:
+		if a.ref == "" && m.unit != "ratio" {
+			return a, fmt.Errorf("%q: percentage needs a reference (target or baseline)", s)
+		}
+		a.value, err = strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+		a.value /= 100
+	case m.unit == "ms":
+		var d time.Duration
+		d, err = time.ParseDuration(v)
+		a.value = toMs(d)
+	default:
+		a.value, err = strconv.ParseFloat(v, 64)
+	}
+	if err != nil {
+		return a, fmt.Errorf("%q: invalid value %s", s, v)
+	}
+	return a, nil
+}
+
+// baselineAssertions are checks of -baseline_tolerance: throughput, median and
+// tail latency must not be worse than baseline by more than tolerance, and no
+// more messages may be lost.
+func baselineAssertions(tolerance float64) []assertion {
+	pct := func(share float64) string { return strconv.FormatFloat(math.Round(1e4*share)/100, 'f', -1, 64) + "%" }
+	var asserts []assertion
+	for _, s := range []string{
+		"throughput >= " + pct(1-tolerance) + " baseline",
+		"p50 <= " + pct(1+tolerance) + " baseline",
+		"p99 <= " + pct(1+tolerance) + " baseline",
+		"missing <= 100% baseline",
+	} {
+		a, err := parseAssertion(s)
+		if err != nil {
+			panic(err)
+		}
+		asserts = append(asserts, a)
+	}
+	return asserts
+}
+
+// loadBaseline reads baseline result, asserts get default baseline checks
+// of tolerance unless some of them already compare to the baseline.
+func loadBaseline(path string, tolerance float64, asserts []assertion) (*Result, []assertion, error) {
+	if tolerance < 0 || tolerance >= 1 {
+		return nil, nil, fmt.Errorf("tolerance must be in [0, 1) range, got %v", tolerance)
+	}
+	res, err := readResult(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, a := range asserts {
+		if a.ref == refBaseline {
+			return &res, asserts, nil
+		}
+	}
+	return &res, append(asserts, baselineAssertions(tolerance)...), nil
+}
+
+// evaluateAssertions checks run result, baseline is optional.
+func evaluateAssertions(asserts []assertion, res Result, baseline *Result) []AssertionResult {
+	var results []AssertionResult
+	for _, a := range asserts {
+		m, _ := lookupMetric(a.metric)
+		r := AssertionResult{Assertion: a.text, Actual: m.value(res), Limit: a.value, Unit: m.unit}
+		switch a.ref {
+		case refTarget:
+			r.Limit = a.value * res.Scenario.targetRate()
+		case refBaseline:
+			if baseline == nil {
+				r.Error = "no baseline result to compare to"
+				results = append(results, r)
+				continue
+			}
+			r.Limit = a.value * m.value(*baseline)
+		}
+		if m.unit == "ms" && latencyCount(a.metric, res) == 0 {
+			r.Error = "no latency samples"
+			results = append(results, r)
+			continue
+		}
+
+		switch a.op {
+		case "<":
+			r.Passed = r.Actual < r.Limit
+		case "<=":
+			r.Passed = r.Actual <= r.Limit
+		case ">":
+			r.Passed = r.Actual > r.Limit
+		case ">=":
+			r.Passed = r.Actual >= r.Limit
+		case "==":
+			r.Passed = r.Actual == r.Limit
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// latencyCount returns number of samples of latency metric.
+func latencyCount(name string, res Result) int64 {
+	for prefix, kind := range latencyKinds {
+		if _, ok := latencyStats[strings.TrimPrefix(name, prefix)]; ok && strings.HasPrefix(name, prefix) {
+			return kind(res.Percentiles).Count
+		}
+	}
+	return 0
+}
+
+// assertionsPassed reports whether all assertions passed.
+func assertionsPassed(results []AssertionResult) bool {
+	for _, r := range results {
+		if !r.Passed {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseAssertion(t *testing.T) {
+	for _, tt := range []struct {
+		text string
+		want assertion // Text is not compared.
+		err  string
+	}{
+		{text: "p99 < 15ms", want: assertion{metric: "p99", op: "<", value: 15}},
+		{text: "ack_p99.9 <= 1.5s", want: assertion{metric: "ack_p99.9", op: "<=", value: 1500}},
+		{text: "corrected_max < 250us", want: assertion{metric: "corrected_max", op: "<", value: 0.25}},
+		{text: "missing == 0", want: assertion{metric: "missing", op: "==", value: 0}},
+		{text: "error_rate < 0.1%", want: assertion{metric: "error_rate", op: "<", value: 0.001}},
+		{text: "error_rate < 0.001", want: assertion{metric: "error_rate", op: "<", value: 0.001}},
+		{text: "throughput >= 95% target", want: assertion{metric: "throughput", op: ">=", value: 0.95, ref: refTarget}},
+		{text: "p50 <= 110% baseline", want: assertion{metric: "p50", op: "<=", value: 1.1, ref: refBaseline}},
+		{text: "data_throughput > 50", want: assertion{metric: "data_throughput", op: ">", value: 50}},
+
+		{text: "p99", err: "want METRIC OP VALUE"},
+		{text: "p99 < 15ms target extra", err: "want METRIC OP VALUE"},
+		{text: "p42 < 15ms", err: "unknown metric p42"},
+		{text: "p99 != 15ms", err: "unknown operator !="},
+		{text: "p99 < 15", err: "invalid value 15"},
+		{text: "missing < lots", err: "invalid value lots"},
+		{text: "p99 < 110%", err: "percentage needs a reference"},
+		{text: "p99 < 110% target", err: "only throughput can be compared to target rate"},
+		{text: "throughput > 95 target", err: "must be a percentage"},
+		{text: "throughput > 95% previous", err: "unknown reference previous"},
+	} {
+		a, err := parseAssertion(tt.text)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%q: got error %v, want %q", tt.text, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.text, err)
+			continue
+		}
+		tt.want.text = tt.text
+		if a.value-tt.want.value > 1e-12 || tt.want.value-a.value > 1e-12 {
+			t.Errorf("%q: got value %v, want %v", tt.text, a.value, tt.want.value)
+		}
+		a.value = tt.want.value
+		if a != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.text, a, tt.want)
+		}
+	}
+}
+
+func TestEvaluateAssertions(t *testing.T) {
+	res := Result{
+		Scenario: &Scenario{Groups: []TopicGroup{
+			{Topics: []string{"t0", "t1"}, Rate: 100, Producers: 2},
+			{Topics: []string{"t2"}, Rate: 200, Producers: 1},
+		}}, // 600 msg/s target.
+		Produced:   9900,
+		Throughput: 580,
+		Percentiles: LatencyPercentiles{
+			Latency: Percentiles{Count: 9900, P50: 2, P99: 12, Max: 40},
+		},
+		Errors: ErrorCounts{ProduceFailed: 100, Missing: 10},
+	}
+	measured := res
+	measured.MeasuredThroughput = &ThroughputEstimate{Mean: 590}
+	baseline := &Result{
+		Throughput:  600,
+		Percentiles: LatencyPercentiles{Latency: Percentiles{Count: 100, P50: 2, P99: 10}},
+		Errors:      ErrorCounts{Missing: 10},
+	}
+
+	for _, tt := range []struct {
+		text     string
+		res      Result
+		baseline *Result
+		actual   float64
+		limit    float64
+		passed   bool
+		err      string
+	}{
+		{text: "p99 < 15ms", res: res, actual: 12, limit: 15, passed: true},
+		{text: "p99 < 12ms", res: res, actual: 12, limit: 12},
+		{text: "p99 <= 12ms", res: res, actual: 12, limit: 12, passed: true},
+		{text: "max > 50ms", res: res, actual: 40, limit: 50},
+		{text: "missing == 0", res: res, actual: 10, limit: 0},
+		{text: "error_rate <= 1.1%", res: res, actual: 0.011, limit: 0.011, passed: true},
+		{text: "throughput >= 95% target", res: res, actual: 580, limit: 570, passed: true},
+		{text: "throughput >= 99% target", res: measured, actual: 590, limit: 594},
+		{text: "p99 <= 110% baseline", res: res, baseline: baseline, actual: 12, limit: 11},
+		{text: "p50 <= 110% baseline", res: res, baseline: baseline, actual: 2, limit: 2.2, passed: true},
+		{text: "missing <= 100% baseline", res: res, baseline: baseline, actual: 10, limit: 10, passed: true},
+		{text: "p99 <= 110% baseline", res: res, actual: 12, limit: 1.1, err: "no baseline result to compare to"},
+		{text: "ack_p99 < 5ms", res: res, actual: 0, limit: 5, err: "no latency samples"},
+	} {
+		a, err := parseAssertion(tt.text)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.text, err)
+		}
+		results := evaluateAssertions([]assertion{a}, tt.res, tt.baseline)
+		if len(results) != 1 {
+			t.Fatalf("%q: got %d results, want 1", tt.text, len(results))
+		}
+		r := results[0]
+		const eps = 1e-9
+		if r.Assertion != tt.text || r.Passed != tt.passed || r.Error != tt.err ||
+			r.Actual-tt.actual > eps || tt.actual-r.Actual > eps || r.Limit-tt.limit > eps || tt.limit-r.Limit > eps {
+			t.Errorf("%q: got %+v, want actual %v, limit %v, passed %v, error %q", tt.text, r, tt.actual, tt.limit, tt.passed, tt.err)
+		}
+	}
+}
+
+func TestBaselineAssertions(t *testing.T) {
+	var texts []string
+	for _, a := range baselineAssertions(0.1) {
+		texts = append(texts, a.text)
+	}
+	want := "throughput >= 90% baseline, p50 <= 110% baseline, p99 <= 110% baseline, missing <= 100% baseline"
+	if got := strings.Join(texts, ", "); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	results := []AssertionResult{{Passed: true}, {Passed: false}}
+	if assertionsPassed(results) || !assertionsPassed(results[:1]) || !assertionsPassed(nil) {
+		t.Errorf("assertionsPassed doesn't require all assertions to pass")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// producerCounts are producer side counters of one producer stream.
+type producerCounts struct {
+	Produced uint64   // Produce calls made (each one takes a sequence number).
+	Acked    uint64   // Produce calls that returned no error.
+	failed   []uint64 // Sequence numbers of failed Produce calls.
+
+	Lag     time.Duration // How far behind schedule the last message was sent.
+	MaxLag  time.Duration // The worst schedule lag during the run.
+	Elapsed time.Duration // Time spent producing.
+}
+
+// undelivered returns number of acknowledged messages of the stream
+// with sequence numbers in [from, to) that were never delivered to the consumer.
+func undelivered(p producerCounts, s *streamStats, from, to uint64) uint64 {
+	to = min64(to, p.Produced)
+	if from >= to {
+		return 0
+	}
+	var n uint64
+	if next := max64(s.next, from); to > next {
+		n = to - next
+	}
+	n += s.missingIn(from, to)
+	// Failed messages are not expected, but they still may arrive.
+	for _, seq := range p.failed {
+		if seq >= from && seq < to && !s.delivered(seq) {
+			n--
+		}
+	}
+
+	return n
+}
+
+// topicAudit compares what was produced to a topic with what was consumed from it.
+type topicAudit struct {
+	Topic       string   `json:"topic"`
+	Produced    uint64   `json:"produced"`
+	Acked       uint64   `json:"acked"`
+	Consumed    uint64   `json:"consumed"`
+	Missing     uint64   `json:"missing"`
+	HeadMissing uint64   `json:"head_missing"` // Missing sent before a stream was first seen.
+	Duplicated  uint64   `json:"duplicated"`
+	Drained     bool     `json:"drained"`    // All acknowledged messages arrived before drain timeout.
+	DrainTime   duration `json:"drain_time"` // Time spent waiting for in-flight messages.
+}
+
+func newTopicAudit(topic string, streams []producerStream) topicAudit {
+	a := topicAudit{Topic: topic}
+	for _, s := range streams {
+		a.Produced += s.Counts.Produced
+		a.Acked += s.Counts.Acked
+		a.Consumed += s.Received
+		a.Duplicated += s.Duplicates
+		a.Missing += s.Missing()
+		a.HeadMissing += s.HeadMissing()
+	}
+
+	return a
+}
+
+// printAudit prints delivery audit table, one row per topic.
+func printAudit(out io.Writer, topics []TopicSummary) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Topic\tProduced\tAcked\tConsumed\tMissing\tHead missing\tDuplicated\tDrain\t")
+	for _, t := range topics {
+		a := t.topicAudit
+		drain := time.Duration(a.DrainTime).Round(time.Millisecond).String()
+		if !a.Drained {
+			drain += " (timeout)"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%s\t\n",
+			a.Topic, a.Produced, a.Acked, a.Consumed, a.Missing, a.HeadMissing, a.Duplicated, drain)
+	}
+	w.Flush()
+}
+
+func min64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a, b uint64) uint64 {
+	if a > b {
+		return a
+	}
+	return b
+}
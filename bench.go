@@ -2,25 +2,25 @@ package main
 
 import (
 	"context"
-	"encoding/csv"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"log"
+	"math/rand"
 	"os"
 	"sort"
-	"strconv"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"streambench/brokers"
-
-	"gonum.org/v1/gonum/stat"
 )
 
+// Progress counters of all topics, results are counted per topic.
 var (
-	txN int64
-	rxN int64
+	txN     int64
+	rxN     int64
+	rxBytes int64
 )
 
 type Producer interface {
@@ -31,67 +31,282 @@ type Consumer interface {
 	Consume(ctx context.Context, topic string) (chan brokers.Message, error)
 }
 
-func runTopic(ctx context.Context, msgSize int, N, M, rate, producers int, brokerType, brokerURLs, topic string) []time.Duration {
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-	latencies := make([]time.Duration, 0, N)
-	start := time.Now().UnixNano()
+// workload is message content shared by all producers of a topic group.
+type workload struct {
+	payload *payloadPool // Shared by all groups.
+	sizes   sizeDist
+	keys    keyDist // nil for messages without keys.
+}
+
+// newWorkloads returns workloads of all topic groups in cfg.Groups order.
+func newWorkloads(cfg Config) ([]*workload, error) {
+	workloads := make([]*workload, len(cfg.Groups))
+	maxSize := 0
+	for i, g := range cfg.Groups {
+		sizes, err := parseSizeDist(g.Size)
+		if err != nil {
+			return nil, fmt.Errorf("group %s: %w", g.Name, err)
+		}
+		keys, err := parseKeyDist(g.Keys)
+		if err != nil {
+			return nil, fmt.Errorf("group %s: %w", g.Name, err)
+		}
+		if sizes.max() > maxSize {
+			maxSize = sizes.max()
+		}
+		workloads[i] = &workload{sizes: sizes, keys: keys}
+	}
 
-	c := NewClient(brokerType, brokerURLs, topic)
-	ch, err := c.Consume(ctx, topic)
+	payload, err := newPayloadPool(cfg.Payload, maxSize)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	for _, w := range workloads {
+		w.payload = payload
 	}
 
+	return workloads, nil
+}
+
+// workloadSeed seeds message sizes and keys of a producer, so that every
+// run of a scenario sends the same sizes and keys.
+func workloadSeed(seed int64, topic string, pidx int) int64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d/%s/%d", seed, topic, pidx)
+	return int64(h.Sum64())
+}
+
+// partitionStats are messages received from a single partition.
+type partitionStats struct {
+	Received uint64
+	Latency  *Histogram
+}
+
+// topicResult is what runTopic measured for a single topic.
+type topicResult struct {
+	topic      string
+	group      string
+	histograms map[streamID]*producerLatencies
+	streams    []producerStream
+	sizes      map[int]*Histogram // Latency per message size bucket.
+	partitions map[int32]*partitionStats
+	audit      topicAudit
+	bytes      uint64        // Consumed bytes.
+	elapsed    time.Duration // Including drain.
+	// tsType is the type of broker timestamps seen by the consumer.
+	tsType brokers.TimestampType
+}
+
+func runTopic(ctx context.Context, runID uint64, cfg Config, series *seriesRecorder, g TopicGroup, w *workload, topic string) (topicResult, error) {
+	// Consumers outlive producers for the drain phase, so they have their own context.
+	cctx, ccancel := context.WithCancel(ctx)
 	cwg := sync.WaitGroup{}
-	cwg.Add(1)
+	var clients []Client // Closed once consumed, so that consumers leave their groups.
+	defer func() {
+		ccancel()
+		cwg.Wait()
+		for _, c := range clients {
+			if err := c.Close(); err != nil {
+				log.Printf("Topic %s client failed to close: %v", topic, err)
+			}
+		}
+	}()
+	histograms := make(map[streamID]*producerLatencies, g.Producers)
+	sizes := make(map[int]*Histogram)
+	partitions := make(map[int32]*partitionStats)
+	runStarts := make(map[uint64]time.Time) // Earliest message of each producing process.
+	mu := sync.Mutex{}                      // Guards consumer side stats above and tsType.
+	tracker := newSeqTracker()
+	tsType := brokers.TimestampUnknown
+	var consumedBytes uint64
+	var lastReceived int64 // UnixNano
+	start := time.Now()
+	shard := series.shard()
 
-	// Consume
-	go func() {
-		defer cwg.Done()
-		i := 0
+	consume := func(ch chan brokers.Message) {
 		for msg := range ch {
-			ns, err := strconv.ParseInt(msg.Value[:19], 10, 64)
+			now := time.Now()
+			e, err := ParseEnvelope(msg.Value)
 			if err != nil {
-				panic(err)
+				if !errors.Is(err, errNotEnvelope) {
+					log.Printf("topic %s: %v", topic, err)
+				}
+				continue
 			}
-			// skip stale or future messages
-			if ns < start || ns >= time.Now().UnixNano() {
+			e = cfg.fromReference(e)
+			// skip messages left from other runs
+			if cfg.Role == roleConsume {
+				// Producers run elsewhere and must start after consumers.
+				if e.IntendedAt < start.UnixNano() {
+					continue
+				}
+			} else if e.RunID != runID {
+				continue
+			}
+			atomic.StoreInt64(&lastReceived, now.UnixNano())
+			if e.End {
+				tracker.end(streamID{RunID: e.RunID, ProducerID: e.ProducerID}, producerCounts{
+					Produced: e.Seq,
+					Acked:    e.Seq - uint64(len(e.Failed)),
+					failed:   e.Failed,
+					Elapsed:  time.Duration(e.SentAt - e.IntendedAt),
+				})
 				continue
 			}
 
+			gap, duplicate := tracker.observe(e)
+			latency := now.Sub(time.Unix(0, e.SentAt))
+			shard.consumed(now, len(msg.Value), latency, gap, duplicate)
+			atomic.AddUint64(&consumedBytes, uint64(len(msg.Value)))
 			atomic.AddInt64(&rxN, 1)
-			latency := time.Since(time.Unix(0, ns))
-			latencies = append(latencies, latency)
-			i++
+			atomic.AddInt64(&rxBytes, int64(len(msg.Value)))
+
+			mu.Lock()
+			if msg.Timestamp != nil {
+				tsType = msg.TimestampType
+			}
+			ps, ok := partitions[msg.Partition]
+			if !ok {
+				ps = &partitionStats{Latency: NewHistogram(cfg.Precision)}
+				partitions[msg.Partition] = ps
+			}
+			ps.Received++
+			runStart := start
+			if cfg.Role == roleConsume {
+				intended := time.Unix(0, e.IntendedAt)
+				if rs, ok := runStarts[e.RunID]; !ok || intended.Before(rs) {
+					runStarts[e.RunID] = intended
+				}
+				runStart = runStarts[e.RunID]
+			}
+			if !cfg.measured(e, runStart) || !series.inSteady(time.Unix(0, e.IntendedAt)) {
+				mu.Unlock()
+				continue
+			}
+			series.measured(time.Unix(0, e.IntendedAt))
+			id := streamID{RunID: e.RunID, ProducerID: e.ProducerID}
+			h, ok := histograms[id]
+			if !ok {
+				h = newProducerLatencies(cfg.Precision)
+				histograms[id] = h
+			}
+			h.Latency.Record(latency)
+			ps.Latency.Record(latency)
+			bucket := sizeBucket(len(msg.Value))
+			sh, ok := sizes[bucket]
+			if !ok {
+				sh = NewHistogram(cfg.Precision)
+				sizes[bucket] = sh
+			}
+			sh.Record(latency)
+			h.Corrected.Record(now.Sub(time.Unix(0, e.IntendedAt)))
+			// Producer set timestamps would make the split meaningless.
+			if msg.Timestamp != nil && msg.TimestampType == brokers.TimestampLogAppend {
+				h.Append.Record(msg.Timestamp.Sub(time.Unix(0, e.SentAt)))
+				h.Delivery.Record(now.Sub(*msg.Timestamp))
+			}
+			mu.Unlock()
 		}
-	}()
+	}
+
+	// Consume, several consumers of a topic share its partitions.
+	if cfg.Role != roleProduce {
+		for cidx := 0; cidx < g.Consumers; cidx++ {
+			c, err := newClient(cfg, topic)
+			if err != nil {
+				return topicResult{}, err
+			}
+			clients = append(clients, c)
+			ch, err := c.Consume(cctx, topic)
+			if err != nil {
+				return topicResult{}, fmt.Errorf("failed to consume: %w", err)
+			}
+
+			cwg.Add(1)
+			go func() {
+				defer cwg.Done()
+				consume(ch)
+			}()
+		}
+	}
 
 	// Produce.
 	pwg := sync.WaitGroup{}
-	for pidx := 0; pidx <= producers; pidx++ {
+	producers := g.Producers
+	if cfg.Role == roleConsume {
+		producers = 0
+	}
+	counts := make([]producerCounts, producers)
+	acks := make([]*Histogram, producers)
+	pclients := make([]Client, producers)
+	scheds := make([]arrivals, producers)
+	for pidx := range pclients {
+		p, err := newClient(cfg, "")
+		if err != nil {
+			return topicResult{}, err
+		}
+		clients = append(clients, p)
+		pclients[pidx] = p
+		if g.Schedule != scheduleClosed {
+			if scheds[pidx], err = newArrivals(g.Schedule, time.Now(), g.Rate, int64(runID)+int64(pidx)); err != nil {
+				return topicResult{}, fmt.Errorf("failed to create producer schedule: %w", err)
+			}
+		}
+	}
+	for pidx := 0; pidx < producers; pidx++ {
 		pwg.Add(1)
-		go func() {
+		go func(pidx int) {
 			defer pwg.Done()
-			p := NewClient(brokerType, brokerURLs, "")
-			i := 0
+			p := pclients[pidx]
+			pc := &counts[pidx]
+			begin := time.Now()
+			defer func() { pc.Elapsed = time.Since(begin) }()
+			ack := NewHistogram(cfg.Precision)
+			acks[pidx] = ack
 			lastProduced := time.Time{}
+			rnd := rand.New(rand.NewSource(workloadSeed(cfg.Payload.Seed, topic, pidx)))
+			buf := make([]byte, 0, w.sizes.max())
+			filler := w.payload.cursor(int64(pidx) * 104729)
+			sched := scheds[pidx]
 			for {
-				// Limit produce rate.
-				if !lastProduced.IsZero() {
-					diff := time.Until(lastProduced.Add(time.Second / time.Duration(rate)))
+				var intended time.Time
+				if sched != nil {
+					// Open loop: wait for the scheduled time, but never skip
+					// messages that are already late.
+					intended = sched.next()
+					if diff := time.Until(intended); diff > 0 {
+						time.Sleep(diff)
+					}
+				} else if !lastProduced.IsZero() {
+					// Limit produce rate.
+					diff := time.Until(lastProduced.Add(time.Second / time.Duration(g.Rate)))
 					if diff > 0 {
 						time.Sleep(diff)
 					}
 				}
 
-				var b strings.Builder
-				b.Grow(msgSize)
 				ts := time.Now()
-				tsStr := strconv.FormatInt(ts.UnixNano(), 10)
-				b.WriteString(tsStr)
-				for n := 0; n < msgSize-len(tsStr); n++ {
-					b.WriteByte(42)
+				if sched == nil {
+					intended = ts
+				}
+				pc.Lag = ts.Sub(intended)
+				if pc.Lag > pc.MaxLag {
+					pc.MaxLag = pc.Lag
+				}
+				e := Envelope{
+					RunID:      runID,
+					ProducerID: uint32(pidx),
+					Seq:        pc.Produced,
+					IntendedAt: intended.UnixNano(),
+					SentAt:     ts.UnixNano(),
+				}
+				key := ""
+				if w.keys != nil {
+					key = formatKey(w.keys.next(rnd, e.Seq))
+				}
+				buf = cfg.toReference(e).AppendTo(buf[:0])
+				if n := w.sizes.next(rnd) - len(buf); n > 0 {
+					buf = filler.appendTo(buf, n)
 				}
 
 				select {
@@ -100,100 +315,320 @@ func runTopic(ctx context.Context, msgSize int, N, M, rate, producers int, broke
 				default:
 				}
 
-				if err := p.Produce(ctx, topic, "", b.String()); err != nil {
-					log.Printf("failed to produce: %v", err)
-					break
+				pc.Produced++
+				series.produced(ts)
+				err := p.Produce(ctx, topic, key, string(buf))
+				series.acked(time.Now(), err)
+				if err != nil {
+					// Keep the schedule running, failures are counted and reported.
+					if len(pc.failed) == 0 {
+						log.Printf("Producer %s failed to produce: %v", topic, err)
+					}
+					pc.failed = append(pc.failed, pc.Produced-1)
+				} else {
+					if cfg.measured(e, start) && series.inSteady(intended) {
+						ack.Record(time.Since(ts))
+						series.measured(intended)
+					}
+					atomic.AddInt64(&txN, 1)
+					pc.Acked++
 				}
-
-				atomic.AddInt64(&txN, 1)
 				lastProduced = ts
-				i++
 
 				// Stop if number of messages is reached.
-				if N > 0 && i >= N {
+				if cfg.Messages > 0 && pc.Produced >= uint64(cfg.Messages) {
 					log.Printf("Producer %s stopping due to message count limit", topic)
 					break
 				}
-				// Stop if number of minutes is reached.
-				if M > 0 && (time.Now().UnixNano()-start)/int64(time.Minute) >= int64(M) {
+				// Stop if time limit is reached.
+				if cfg.Duration > 0 && time.Since(start) >= cfg.Duration {
 					log.Printf("Producer %s stopping due to time limit", topic)
 					break
 				}
 			}
-		}()
+
+			// Tell consumers running elsewhere what to expect.
+			if cfg.Role == roleProduce {
+				end := Envelope{
+					End:        true,
+					RunID:      runID,
+					ProducerID: uint32(pidx),
+					Seq:        pc.Produced,
+					IntendedAt: begin.UnixNano(),
+					SentAt:     time.Now().UnixNano(),
+					Failed:     pc.failed,
+				}
+				if err := produceEnd(ctx, p, topic, cfg.toReference(end)); err != nil {
+					log.Printf("Producer %s failed to send end of stream: %v", topic, err)
+				}
+			}
+		}(pidx)
 	}
 
 	pwg.Wait() // Wait for producers to finish.
-	cancel()
-	// cwg.Wait() // Wait for consumer to finish.
+	if cfg.Role != roleConsume {
+		series.stopped(time.Now())
+	}
+	for pidx, c := range counts {
+		tracker.end(streamID{RunID: runID, ProducerID: uint32(pidx)}, c)
+	}
+
+	// Drain: keep consuming until every acknowledged message arrives or timeout expires.
+	drainStart := time.Now()
+	drained, drainTime := true, time.Duration(0)
+	switch cfg.Role {
+	case roleBoth:
+		drained = waitDrain(ctx, cfg.Drain, tracker.complete)
+		drainTime = time.Since(drainStart)
+	case roleConsume:
+		// Producers run elsewhere, wait for their streams to end. They may
+		// never start, or produce elsewhere, so the first message is awaited
+		// for the run time and drain at most.
+		drained = waitIdle(ctx, cfg.Duration+cfg.Drain, cfg.Drain, &lastReceived, tracker.complete)
+		if atomic.LoadInt64(&lastReceived) == 0 {
+			log.Printf("Consumer %s received nothing within %v", topic, cfg.Duration+cfg.Drain)
+		}
+		if end := tracker.lastEnd(); !end.IsZero() {
+			drainTime = time.Since(end)
+			series.stopped(end)
+		}
+	}
+	if !drained {
+		log.Printf("Consumer %s drain timed out after %v", topic, drainTime.Round(time.Millisecond))
+	}
+
+	ccancel()
+	cwg.Wait() // Wait for consumer to finish.
+
+	for pidx, ack := range acks {
+		id := streamID{RunID: runID, ProducerID: uint32(pidx)}
+		h, ok := histograms[id]
+		if !ok {
+			h = newProducerLatencies(cfg.Precision)
+			histograms[id] = h
+		}
+		if err := h.Ack.Merge(ack); err != nil {
+			return topicResult{}, fmt.Errorf("failed to merge ack latencies: %w", err)
+		}
+	}
+
+	streams := tracker.Streams()
+	if cfg.Role == roleProduce {
+		// Nothing is consumed here, delivery is audited by consumers.
+		for i := range streams {
+			streams[i].Ended = false
+		}
+	}
+	audit := newTopicAudit(topic, streams)
+	audit.Drained = drained
+	audit.DrainTime = duration(drainTime)
+
+	return topicResult{
+		topic:      topic,
+		group:      g.Name,
+		histograms: histograms,
+		sizes:      sizes,
+		partitions: partitions,
+		streams:    streams,
+		audit:      audit,
+		bytes:      atomic.LoadUint64(&consumedBytes),
+		elapsed:    time.Since(start),
+		tsType:     tsType,
+	}, nil
+}
+
+// produceEnd sends end of stream marker, retrying a few times
+// since consumers can't tell a stream is over without it.
+func produceEnd(ctx context.Context, p Producer, topic string, e Envelope) error {
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		if err = p.Produce(ctx, topic, "", string(e.AppendTo(nil))); err == nil || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// waitIdle polls done until it returns true, ctx is canceled, nothing
+// is received for idle time after the first message or the first message
+// doesn't arrive within first.
+func waitIdle(ctx context.Context, first, idle time.Duration, lastReceived *int64, done func() bool) bool {
+	begin := time.Now()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for !done() {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+		last := atomic.LoadInt64(lastReceived)
+		if last == 0 && time.Since(begin) > first || last != 0 && time.Since(time.Unix(0, last)) > idle {
+			return done()
+		}
+	}
+
+	return true
+}
+
+// Progress is a snapshot of a running benchmark.
+type Progress struct {
+	Produced      int64    `json:"produced"`
+	Consumed      int64    `json:"consumed"`
+	ConsumedBytes int64    `json:"consumed_bytes"`
+	Elapsed       duration `json:"elapsed"`
+}
 
-	return latencies
+func (p Progress) String() string {
+	mps := 0
+	mbps := 0.0
+	elapsed := time.Duration(p.Elapsed)
+	if p.Consumed > 0 && elapsed.Seconds() >= 1 {
+		mps = int(float64(p.Consumed) / elapsed.Seconds())
+		mbps = float64(p.ConsumedBytes) / elapsed.Seconds() / 1024 / 1024
+	}
+	return fmt.Sprintf("Produced: %d, Consumed: %d (%d messages/sec, %.2f Mb/sec, running for %v)", p.Produced, p.Consumed, mps, mbps, elapsed)
+}
+
+// waitDrain polls done until it returns true, timeout expires or ctx is canceled.
+func waitDrain(ctx context.Context, timeout time.Duration, done func() bool) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for !done() {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-deadline.C:
+			return done()
+		case <-ticker.C:
+		}
+	}
+
+	return true
 }
 
 type Client interface {
 	Producer
 	Consumer
+	Close() error
 }
 
+// newClient creates clients of a run, tests replace it with an in-memory broker.
+var newClient = NewClient
+
 // NewClient returns Producer it topic is empty, and Consumer otherwize.
-func NewClient(brokerType, brokerURLs, topic string) Client {
-	switch brokerType {
+func NewClient(cfg Config, topic string) (Client, error) {
+	switch cfg.Driver {
 	case "pulsar":
-		k, err := brokers.NewPulsar(brokerURLs, topic)
+		k, err := brokers.NewPulsar(cfg.Brokers, topic, cfg.Options)
 		if err != nil {
-			log.Fatalf("failed to create Pulsar client: %v", err)
+			return nil, fmt.Errorf("failed to create Pulsar client: %w", err)
 		}
-		return k
+		return k, nil
 	case "nats":
-		n, err := brokers.NewNats(brokerURLs, "s") // hardcoded stream name
+		n, err := brokers.NewNats(cfg.Brokers, "s", cfg.Options) // hardcoded stream name
 		if err != nil {
-			log.Fatalf("failed to create Nats JetStream client: %v", err)
+			return nil, fmt.Errorf("failed to create Nats JetStream client: %w", err)
 		}
-		return n
+		return n, nil
 	case "kafka":
-		k := brokers.NewKafka(brokerURLs, topic)
-		return k
+		k := brokers.NewKafka(cfg.Brokers, topic, cfg.Options)
+		return k, nil
 	case "redpanda":
-		rp, err := brokers.NewRedPanda(brokerURLs, topic)
+		rp, err := brokers.NewRedPanda(cfg.Brokers, topic, cfg.Options)
 		if err != nil {
-			log.Fatalf("failed to create RedPanda client: %v", err)
+			return nil, fmt.Errorf("failed to create RedPanda client: %w", err)
 		}
-		return rp
+		return rp, nil
 	}
 
-	log.Fatalf("unknown broker type: %s", brokerType)
-	return nil
+	return nil, fmt.Errorf("unknown broker type: %s", cfg.Driver)
 }
 
-func RunBench(ctx context.Context, msgSize int, N, M, rate, producers int, brokerType, brokerURLs, topics string) {
+// RunBench runs benchmark, prints report and returns result document.
+// The run fails if a topic fails, e.g. its broker can't be reached.
+func RunBench(ctx context.Context, cfg Config) (Result, error) {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	latencies := make([]time.Duration, 0, N*len(strings.Split(topics, ",")))
+	// Runs may follow each other in a sweep.
+	atomic.StoreInt64(&txN, 0)
+	atomic.StoreInt64(&rxN, 0)
+	atomic.StoreInt64(&rxBytes, 0)
+
+	latencies := newProducerLatencies(cfg.Precision)
+	sizes := make(map[int]*Histogram)
+	results := make([]topicResult, 0)
+	runID := newRunID()
+	workloads, err := newWorkloads(cfg)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to prepare workload: %w", err)
+	}
 	start := time.Now()
+	series := newSeriesRecorder(start, cfg)
 
 	wg := sync.WaitGroup{}
-	ch := make(chan []time.Duration, 10)
-
-	for _, topic := range strings.Split(topics, ",") {
-		wg.Add(1)
-		go func(topic string) {
-			defer wg.Done()
-			ch <- runTopic(ctx, msgSize, N, M, rate, producers, brokerType, brokerURLs, topic)
-		}(topic)
+	ch := make(chan topicResult, 10)
+	var mu sync.Mutex // Guards runErr.
+	var runErr error  // The first failure, other topics are canceled.
+
+	for i, g := range cfg.Groups {
+		for _, topic := range g.Topics {
+			wg.Add(1)
+			go func(g TopicGroup, w *workload, topic string) {
+				defer wg.Done()
+				res, err := runTopic(ctx, runID, cfg, series, g, w, topic)
+				if err != nil {
+					mu.Lock()
+					if runErr == nil {
+						runErr = fmt.Errorf("topic %s: %w", topic, err)
+						cancel()
+					}
+					mu.Unlock()
+					return
+				}
+				ch <- res
+			}(g, workloads[i], topic)
+		}
 	}
 
-	// Append latencies.
+	// Merge latencies.
 	wgl := sync.WaitGroup{}
 	wgl.Add(1)
+	var mergeErr error
 	go func() {
 		defer wgl.Done()
-		for ls := range ch {
-			// Trim first 10%  and last 10% of latencies slice
-			// to account for broker "warm up" time and shutdown part (some producers can
-			// finish earlier than others that will make tail of the latencies more sparse).
-			cut := len(ls) / 10
-			latencies = append(latencies, ls[cut:len(ls)-cut]...)
+		for res := range ch {
+			results = append(results, res)
+			for _, h := range res.histograms {
+				if err := latencies.merge(h); err != nil && mergeErr == nil {
+					mergeErr = fmt.Errorf("failed to merge latencies: %w", err)
+				}
+			}
+			for b, h := range res.sizes {
+				if _, ok := sizes[b]; !ok {
+					sizes[b] = NewHistogram(cfg.Precision)
+				}
+				if err := sizes[b].Merge(h); err != nil && mergeErr == nil {
+					mergeErr = fmt.Errorf("failed to merge latencies: %w", err)
+				}
+			}
+		}
+	}()
+
+	// Summarize time series intervals and detect steady state.
+	go func() {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				series.tick(now)
+			}
 		}
 	}()
 
@@ -208,18 +643,16 @@ func RunBench(ctx context.Context, msgSize int, N, M, rate, producers int, broke
 			case <-ticker.C:
 			}
 
-			rx := atomic.LoadInt64(&rxN)
-			tx := atomic.LoadInt64(&txN)
-
-			mps := 0
-			mbps := 0.0
-			elapsed := time.Since(start)
-			if rx > 0 && elapsed.Seconds() >= 1 {
-				mps = int(float64(rx) / elapsed.Seconds())
-				mbps = float64(rx*int64(msgSize)) / elapsed.Seconds() / 1024 / 1024
+			p := Progress{
+				Produced:      atomic.LoadInt64(&txN),
+				Consumed:      atomic.LoadInt64(&rxN),
+				ConsumedBytes: atomic.LoadInt64(&rxBytes),
+				Elapsed:       duration(time.Since(start)),
+			}
+			log.Print(p)
+			if cfg.Progress != nil {
+				cfg.Progress(p)
 			}
-
-			log.Printf("Produced: %d, Consumed: %d (%d messages/sec, %.2f Mb/sec, running for %v)", tx, rx, mps, mbps, elapsed)
 		}
 	}()
 
@@ -227,58 +660,74 @@ func RunBench(ctx context.Context, msgSize int, N, M, rate, producers int, broke
 	cancel()
 	close(ch)
 	wgl.Wait()
+	if runErr != nil {
+		return Result{}, runErr
+	}
+	if mergeErr != nil {
+		return Result{}, mergeErr
+	}
 
-	elapsed := time.Since(start)
-	N = int(atomic.LoadInt64(&rxN))
-	if N == 0 {
-		log.Printf("No messages received in %v", elapsed)
-		return
+	end := time.Now()
+	elapsed := end.Sub(start)
+	result := Result{
+		Schema:      resultSchema,
+		RunID:       fmt.Sprintf("%016x", runID),
+		Role:        cfg.Role,
+		Scenario:    cfg.Scenario,
+		Environment: newEnvironment(),
+		Start:       start,
+		End:         end,
+		Elapsed:     duration(elapsed),
+		Payload:     workloads[0].payload.name,
+		Window:      cfg.window(),
+		Percentiles: newLatencyPercentiles(latencies),
+		Latencies:   latencies,
+		Series:      series.series(end),
+		Drained:     true,
 	}
+	result.MeasuredThroughput = newThroughputEstimate(result.Series)
 
-	fmt.Printf("Message throughput: %.2f messages/sec\n", float64(N)/elapsed.Seconds())
-	fmt.Printf("Data throughput: %f Mb/sec\n", (float64(N*msgSize)/elapsed.Seconds())/1024/1024)
+	if cfg.Steady != nil {
+		result.Window.SteadyAt = duration(series.steadyTime())
+		if result.Window.SteadyAt == 0 {
+			log.Printf("Steady state was not reached, latency is not measured")
+		}
+	}
 
-	flats := make([]float64, len(latencies))
-	for i, l := range latencies {
-		flats[i] = float64(l) / float64(time.Millisecond)
+	buckets := make([]int, 0, len(sizes))
+	for b := range sizes {
+		buckets = append(buckets, b)
+	}
+	sort.Ints(buckets)
+	for _, b := range buckets {
+		result.Sizes = append(result.Sizes, SizeSummary{Bucket: sizeBucketName(b), MaxSize: 1 << b, Latency: newPercentilesCI(sizes[b]), Histogram: sizes[b]})
 	}
 
-	sort.Slice(latencies, func(i, j int) bool {
-		return latencies[i] < latencies[j]
-	})
-
-	N = len(latencies) // This one is smaller than rxN because we trim first 10% of warmup time.
-	fmt.Printf("Min latency: %v\n", ms(latencies[0]))
-	fmt.Printf("P50 latency: %v\n", ms(latencies[N/2]))
-	fmt.Printf("P90 latency: %v\n", ms(latencies[N-N/10]))
-	fmt.Printf("P99 latency: %v\n", ms(latencies[N-N/100]))
-	fmt.Printf("P99.9 latency: %v\n", ms(latencies[N-N/1000]))
-	fmt.Printf("Max latency: %v\n", ms(latencies[N-1]))
-
-	stddev := stat.StdDev(flats, nil)
-	fmt.Printf("Latency StdDev: %.6f\n", stddev)
-	fmt.Printf("Latency StdErr: %.6f\n", stat.StdErr(stddev, float64(N)))
-	fmt.Printf("Total elapsed time: %v\n", time.Since(start))
-	fmt.Printf("Commandline arguments: %s\n", strings.Join(os.Args[1:], " "))
-
-	f, err := os.OpenFile("latencies.csv", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
-	defer f.Close()
-	if err != nil {
-		log.Fatalf("failed to open file: %v", err)
+	sort.Slice(results, func(i, j int) bool { return results[i].topic < results[j].topic })
+	for _, res := range results {
+		t, err := newTopicSummary(res, cfg.Precision)
+		if err != nil {
+			return Result{}, fmt.Errorf("failed to merge latencies: %w", err)
+		}
+		result.addTopic(t)
 	}
-	w := csv.NewWriter(f)
-	defer w.Flush()
-	for i, f := range flats {
-		// Sample 10% of latencies (to moving gigabytes of floats over network).
-		if i%10 > 0 {
-			continue
+	result.ProduceThroughput = float64(result.Produced) / elapsed.Seconds()
+	result.Throughput = float64(result.Consumed) / elapsed.Seconds()
+	result.DataThroughput = float64(result.ConsumedBytes) / elapsed.Seconds() / 1024 / 1024
+	result.Assertions = evaluateAssertions(cfg.Assertions, result, cfg.Baseline)
+
+	printResult(os.Stdout, result)
+
+	if cfg.ResultFile != "" {
+		if err := writeResult(cfg.ResultFile, result); err != nil {
+			return result, fmt.Errorf("failed to write result: %w", err)
 		}
-		if err := w.Write([]string{strconv.FormatFloat(f, 'g', 5, 64)}); err != nil {
-			log.Fatalf("failed to write csv: %v", err)
+	}
+	if cfg.SeriesFile != "" {
+		if err := writeSeries(cfg.SeriesFile, result.Series); err != nil {
+			return result, fmt.Errorf("failed to write time series: %w", err)
 		}
 	}
-}
 
-func ms(d time.Duration) string {
-	return fmt.Sprintf("%d ms.", d.Milliseconds())
+	return result, nil
 }
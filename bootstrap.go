@@ -0,0 +1,138 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+const (
+	// confidence is the level of reported confidence intervals.
+	confidence = 0.95
+	// bootstrapReplicates is the number of bootstrap resamples per confidence interval.
+	bootstrapReplicates = 1000
+)
+
+// ConfidenceInterval is a bootstrap percentile confidence interval
+// at confidence level.
+type ConfidenceInterval struct {
+	Low  float64 `json:"low"`
+	High float64 `json:"high"`
+}
+
+// PercentileCI are confidence intervals of Percentiles, in milliseconds.
+type PercentileCI struct {
+	P50  ConfidenceInterval `json:"p50"`
+	P90  ConfidenceInterval `json:"p90"`
+	P99  ConfidenceInterval `json:"p99"`
+	P999 ConfidenceInterval `json:"p99_9"`
+}
+
+// ThroughputEstimate is consumed messages per second in the measurement
+// window: the mean of its time series intervals.
+type ThroughputEstimate struct {
+	Mean      float64            `json:"mean"`
+	CI        ConfidenceInterval `json:"ci"`
+	Intervals int                `json:"intervals"` // Number of intervals it is estimated from.
+}
+
+// newPercentileCI bootstraps confidence intervals of h percentiles.
+// Every histogram gets the same random sequence, so reports are reproducible.
+func newPercentileCI(h *Histogram) *PercentileCI {
+	rnd := rand.New(rand.NewSource(1))
+	counts, values := h.cumulative()
+	ci := func(q float64) ConfidenceInterval {
+		return quantileCI(counts, values, h.Count(), q, rnd)
+	}
+	return &PercentileCI{P50: ci(0.5), P90: ci(0.9), P99: ci(0.99), P999: ci(0.999)}
+}
+
+// quantileCI bootstraps nearest rank quantile q of n values given by
+// cumulative bucket counts and values (see Histogram.cumulative).
+//
+// Rank r value of a resample is the empirical quantile function at rank r
+// of n uniform values, which is Beta(r, n-r+1) distributed. So a replicate
+// takes a single Beta draw instead of resampling all n values.
+func quantileCI(counts, values []int64, n int64, q float64, rnd *rand.Rand) ConfidenceInterval {
+	r := nearestRank(q, n)
+	replicates := make([]float64, bootstrapReplicates)
+	for i := range replicates {
+		u := betaRand(rnd, float64(r), float64(n-r+1))
+		rank := nearestRank(u, n)
+		j := sort.Search(len(counts), func(j int) bool { return counts[j] >= rank })
+		replicates[i] = toMs(time.Duration(values[j]) * time.Microsecond)
+	}
+	return percentileInterval(replicates)
+}
+
+// newThroughputEstimate estimates throughput from measure phase intervals
+// of s, nil if there are less than two of them.
+func newThroughputEstimate(s *Series) *ThroughputEstimate {
+	if s == nil {
+		return nil
+	}
+	var x []float64
+	for _, p := range s.Points {
+		if p.Phase == phaseMeasure {
+			x = append(x, p.Throughput)
+		}
+	}
+	if len(x) < 2 {
+		return nil
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	mean := func(x []float64) float64 {
+		var sum float64
+		for _, v := range x {
+			sum += v
+		}
+		return sum / float64(len(x))
+	}
+	replicates := make([]float64, bootstrapReplicates)
+	resample := make([]float64, len(x))
+	for i := range replicates {
+		for j := range resample {
+			resample[j] = x[rnd.Intn(len(x))]
+		}
+		replicates[i] = mean(resample)
+	}
+
+	return &ThroughputEstimate{Mean: mean(x), CI: percentileInterval(replicates), Intervals: len(x)}
+}
+
+// percentileInterval returns the central confidence share of bootstrap replicates.
+func percentileInterval(replicates []float64) ConfidenceInterval {
+	sort.Float64s(replicates)
+	alpha := (1 - confidence) / 2
+	n := float64(len(replicates))
+	return ConfidenceInterval{
+		Low:  replicates[int(alpha*n)],
+		High: replicates[int(math.Ceil((1-alpha)*n))-1],
+	}
+}
+
+// betaRand draws from Beta(a, b) distribution, a and b are at least 1.
+func betaRand(rnd *rand.Rand, a, b float64) float64 {
+	x := gammaRand(rnd, a)
+	return x / (x + gammaRand(rnd, b))
+}
+
+// gammaRand draws from Gamma(a, 1) distribution with Marsaglia and Tsang
+// method, a is at least 1.
+func gammaRand(rnd *rand.Rand, a float64) float64 {
+	d := a - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := rnd.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		if math.Log(rnd.Float64()) < 0.5*x*x+d-d*v+d*math.Log(v) {
+			return d * v
+		}
+	}
+}
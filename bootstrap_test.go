@@ -0,0 +1,125 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestPercentileInterval(t *testing.T) {
+	replicates := make([]float64, 1000)
+	for i := range replicates {
+		replicates[i] = float64(1000 - i) // Sorted by percentileInterval.
+	}
+	if got, want := percentileInterval(replicates), (ConfidenceInterval{Low: 26, High: 975}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+// TestQuantileCI checks that confidence intervals of exponential samples
+// cover true quantiles about as often as the confidence level tells.
+func TestQuantileCI(t *testing.T) {
+	const (
+		trials = 200
+		n      = 2000
+		mean   = 1000.0 // Microseconds.
+	)
+	quantiles := []struct {
+		q  float64
+		ci func(*PercentileCI) ConfidenceInterval
+	}{
+		{0.5, func(ci *PercentileCI) ConfidenceInterval { return ci.P50 }},
+		{0.9, func(ci *PercentileCI) ConfidenceInterval { return ci.P90 }},
+		{0.99, func(ci *PercentileCI) ConfidenceInterval { return ci.P99 }},
+	}
+	covered := make([]int, len(quantiles))
+	rnd := rand.New(rand.NewSource(1))
+	for trial := 0; trial < trials; trial++ {
+		h := NewHistogram(3)
+		for i := 0; i < n; i++ {
+			h.RecordValue(int64(rnd.ExpFloat64()*mean), 1)
+		}
+		ci := newPercentileCI(h)
+		for i, qt := range quantiles {
+			q, c := qt.q, qt.ci(ci)
+			estimate := toMs(h.Quantile(q))
+			if c.Low > estimate || c.High < estimate {
+				t.Fatalf("P%v confidence interval %+v doesn't contain the estimate %v", 100*q, c, estimate)
+			}
+			if truth := -math.Log(1-q) * mean / 1000; c.Low <= truth && truth <= c.High {
+				covered[i]++
+			}
+		}
+	}
+	for i, qt := range quantiles {
+		q := qt.q
+		if share := float64(covered[i]) / trials; share < 0.88 || share > 0.995 {
+			t.Errorf("P%v confidence interval covers true quantile in %.1f%% of trials, want about %v%%", 100*q, 100*share, 100*confidence)
+		}
+	}
+}
+
+func TestQuantileCIReproducible(t *testing.T) {
+	h := NewHistogram(3)
+	for i := int64(1); i <= 10000; i++ {
+		h.Record(time.Duration(i) * time.Microsecond)
+	}
+	a, b := newPercentileCI(h), newPercentileCI(h)
+	if *a != *b {
+		t.Errorf("confidence intervals differ: %+v and %+v", a, b)
+	}
+	if a.P50.Low >= a.P50.High || a.P50.High >= a.P90.Low || a.P90.High >= a.P99.Low || a.P99.High > a.P999.High {
+		t.Errorf("confidence intervals are not ordered: %+v", a)
+	}
+}
+
+func TestBetaRand(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, tt := range []struct{ a, b float64 }{{1, 1}, {2, 5}, {50, 950}, {999, 2}} {
+		const n = 100000
+		var sum float64
+		for i := 0; i < n; i++ {
+			x := betaRand(rnd, tt.a, tt.b)
+			if x < 0 || x > 1 {
+				t.Fatalf("Beta(%v, %v) draw %v is out of [0, 1]", tt.a, tt.b, x)
+			}
+			sum += x
+		}
+		want := tt.a / (tt.a + tt.b)
+		std := math.Sqrt(tt.a * tt.b / ((tt.a + tt.b) * (tt.a + tt.b) * (tt.a + tt.b + 1)))
+		if got := sum / n; math.Abs(got-want) > 5*std/math.Sqrt(n) {
+			t.Errorf("Beta(%v, %v) mean is %v, want %v", tt.a, tt.b, got, want)
+		}
+	}
+}
+
+func TestThroughputEstimate(t *testing.T) {
+	points := func(phases []string, throughput []float64) *Series {
+		s := &Series{Interval: duration(time.Second)}
+		for i := range phases {
+			s.Points = append(s.Points, SeriesPoint{Phase: phases[i], Throughput: throughput[i]})
+		}
+		return s
+	}
+
+	if e := newThroughputEstimate(nil); e != nil {
+		t.Errorf("got %+v without series, want none", e)
+	}
+	if e := newThroughputEstimate(points([]string{phaseWarmup, phaseMeasure, phaseDrain}, []float64{1, 2, 3})); e != nil {
+		t.Errorf("got %+v of a single interval, want none", e)
+	}
+
+	e := newThroughputEstimate(points(
+		[]string{phaseWarmup, phaseMeasure, phaseMeasure, phaseMeasure, phaseMeasure, phaseCooldown, phaseDrain},
+		[]float64{10, 100, 110, 90, 100, 50, 5}))
+	if e == nil {
+		t.Fatal("no estimate")
+	}
+	if e.Mean != 100 || e.Intervals != 4 {
+		t.Errorf("got mean %v of %d intervals, want 100 of 4", e.Mean, e.Intervals)
+	}
+	if e.CI.Low < 90 || e.CI.Low >= 100 || e.CI.High <= 100 || e.CI.High > 110 {
+		t.Errorf("got confidence interval %+v, want one around 100 within 90..110", e.CI)
+	}
+}
@@ -5,28 +5,36 @@ import (
 	"errors"
 	"log"
 	"strings"
+	"sync"
 	"time"
 
 	kafka "github.com/segmentio/kafka-go"
 )
 
 type Kafka struct {
+	urls   []string
 	writer *kafka.Writer
 	reader *kafka.Reader
 }
 
-func NewKafka(url, topic string) *Kafka {
+func NewKafka(url, topic string, opts Options) *Kafka {
 	urls := strings.Split(url, ",")
 	k := Kafka{
+		urls: urls,
 		writer: &kafka.Writer{
 			Addr:         kafka.TCP(urls...),
-			BatchSize:    100,
-			BatchTimeout: time.Millisecond,
-			RequiredAcks: kafka.RequireAll,
-			Balancer:     &kafka.RoundRobin{},
-			Compression:  kafka.Snappy,
+			BatchSize:    opts.BatchSize,
+			BatchBytes:   int64(opts.BatchBytes),
+			BatchTimeout: opts.Linger,
+			RequiredAcks: kafkaAcks[opts.Acks],
+			Balancer:     &kafka.Hash{}, // Round robin for messages without key.
+			Compression:  kafkaCompression[opts.Compression],
 		},
 	}
+	// Zero batch timeout means one second default in kafka-go.
+	if opts.Linger == 0 {
+		k.writer.BatchTimeout = time.Nanosecond
+	}
 
 	if topic != "" {
 		k.reader = kafka.NewReader(kafka.ReaderConfig{
@@ -40,12 +48,40 @@ func NewKafka(url, topic string) *Kafka {
 	return &k
 }
 
+var kafkaAcks = map[string]kafka.RequiredAcks{
+	AcksNone:   kafka.RequireNone,
+	AcksLeader: kafka.RequireOne,
+	AcksAll:    kafka.RequireAll,
+}
+
+var kafkaCompression = map[string]kafka.Compression{
+	CompressionNone:   0,
+	CompressionGzip:   kafka.Gzip,
+	CompressionSnappy: kafka.Snappy,
+	CompressionLz4:    kafka.Lz4,
+	CompressionZstd:   kafka.Zstd,
+}
+
+// Close closes the writer and the reader of a consumer, so that it leaves
+// the consumer group: canceling Consume context only stops reading.
+func (k *Kafka) Close() error {
+	err := k.writer.Close()
+	if k.reader != nil {
+		if rerr := k.reader.Close(); err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
 func (k *Kafka) Produce(ctx context.Context, topic, key, value string) error {
 	msg := kafka.Message{
 		Topic: topic,
-		Key:   []byte(key),
 		Value: []byte(value),
 	}
+	if key != "" {
+		msg.Key = []byte(key)
+	}
 
 	return k.writer.WriteMessages(ctx, msg)
 }
@@ -54,13 +90,18 @@ func (k *Kafka) Consume(ctx context.Context, topic string) (chan Message, error)
 	if k.reader == nil {
 		return nil, errors.New("not created as a consumer (no topic provided)")
 	}
+	tsType := k.timestampType(ctx, topic)
 	ch := make(chan Message)
+	wg := sync.WaitGroup{}
+	wg.Add(1)
 	go func() {
 		<-ctx.Done()
+		wg.Wait()
 		close(ch)
 	}()
 
 	go func() {
+		defer wg.Done()
 		for {
 			m, err := k.reader.ReadMessage(ctx)
 			if err != nil {
@@ -75,9 +116,11 @@ func (k *Kafka) Consume(ctx context.Context, topic string) (chan Message, error)
 			case <-ctx.Done():
 				return
 			case ch <- Message{
-				Key:       string(m.Key),
-				Value:     string(m.Value),
-				Timestamp: &m.Time,
+				Key:           string(m.Key),
+				Value:         string(m.Value),
+				Partition:     int32(m.Partition),
+				Timestamp:     &m.Time,
+				TimestampType: tsType,
 			}:
 			}
 		}
@@ -85,3 +128,38 @@ func (k *Kafka) Consume(ctx context.Context, topic string) (chan Message, error)
 
 	return ch, nil
 }
+
+// ResetTopics deletes and recreates topics.
+func (k *Kafka) ResetTopics(ctx context.Context, topics []string) error {
+	return resetKafkaTopics(ctx, k.urls, topics)
+}
+
+// timestampType looks up message.timestamp.type topic config,
+// as kafka-go doesn't expose record timestamp type.
+func (k *Kafka) timestampType(ctx context.Context, topic string) TimestampType {
+	cl := &kafka.Client{Addr: kafka.TCP(k.urls...), Timeout: 10 * time.Second}
+	resp, err := cl.DescribeConfigs(ctx, &kafka.DescribeConfigsRequest{
+		Resources: []kafka.DescribeConfigRequestResource{{
+			ResourceType: kafka.ResourceTypeTopic,
+			ResourceName: topic,
+			ConfigNames:  []string{"message.timestamp.type"},
+		}},
+	})
+	if err != nil {
+		log.Printf("failed to describe topic %s config: %v", topic, err)
+		return TimestampUnknown
+	}
+
+	for _, res := range resp.Resources {
+		for _, e := range res.ConfigEntries {
+			switch e.ConfigValue {
+			case "CreateTime":
+				return TimestampCreate
+			case "LogAppendTime":
+				return TimestampLogAppend
+			}
+		}
+	}
+
+	return TimestampUnknown
+}
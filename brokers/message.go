@@ -3,7 +3,31 @@ package brokers
 import "time"
 
 type Message struct {
-	Key       string
-	Value     string
-	Timestamp *time.Time
+	Key           string
+	Value         string
+	Partition     int32 // -1 if the broker has no partitions.
+	Timestamp     *time.Time
+	TimestampType TimestampType
+}
+
+// TimestampType tells who has set Message.Timestamp.
+type TimestampType int
+
+const (
+	// TimestampUnknown means the driver can't tell where the timestamp comes from.
+	TimestampUnknown TimestampType = iota
+	// TimestampCreate is set by the producer (Kafka CreateTime).
+	TimestampCreate
+	// TimestampLogAppend is set by the broker when the message is stored (Kafka LogAppendTime).
+	TimestampLogAppend
+)
+
+func (t TimestampType) String() string {
+	switch t {
+	case TimestampCreate:
+		return "CreateTime"
+	case TimestampLogAppend:
+		return "LogAppendTime"
+	}
+	return "unknown"
 }
@@ -6,18 +6,20 @@ import (
 	"fmt"
 	"log"
 	"sync"
-	"time"
 
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
 )
 
 type Nats struct {
-	cl *nats.Conn
-	js nats.JetStreamContext
+	cl     *nats.Conn
+	js     nats.JetStreamContext
+	stream string
+	opts   Options
 }
 
-func NewNats(url, topic string) (*Nats, error) {
-	n := &Nats{}
+func NewNats(url, stream string, opts Options) (*Nats, error) {
+	n := &Nats{stream: stream, opts: opts}
 	nc, err := nats.Connect(url)
 	if err != nil {
 		return nil, err
@@ -33,8 +35,36 @@ func NewNats(url, topic string) (*Nats, error) {
 	return n, nil
 }
 
+// Close closes the connection.
+func (n *Nats) Close() error {
+	n.cl.Close()
+	return nil
+}
+
+// ResetTopics purges messages of the subjects from the stream.
+func (n *Nats) ResetTopics(_ context.Context, subjects []string) error {
+	for _, s := range subjects {
+		if err := n.js.PurgeStream(n.stream, &nats.StreamPurgeRequest{Subject: s}); err != nil {
+			return fmt.Errorf("failed to purge %s from stream %s: %w", s, n.stream, err)
+		}
+	}
+
+	return nil
+}
+
 func (n *Nats) Produce(ctx context.Context, topic, key, value string) error {
-	_, err := n.js.Publish(topic, []byte(value))
+	// Core NATS publish doesn't wait for the stream to store the message.
+	if n.opts.Acks == AcksNone {
+		return n.cl.Publish(topic, []byte(value))
+	}
+
+	// JetStream acknowledges after the replication quorum stored the message,
+	// so leader and all acks are the same here.
+	var opts []nats.PubOpt
+	if n.opts.Idempotent {
+		opts = append(opts, nats.MsgId(nuid.Next()))
+	}
+	_, err := n.js.Publish(topic, []byte(value), opts...)
 
 	return err
 }
@@ -49,7 +79,8 @@ func (n *Nats) Consume(ctx context.Context, subject string) (chan Message, error
 		close(ch)
 	}()
 
-	sub, err := n.js.SubscribeSync(subject, nats.AckAll(), nats.Durable(subject))
+	// Queue subscription lets several consumers share the durable consumer.
+	sub, err := n.js.QueueSubscribeSync(subject, subject, nats.AckAll(), nats.Durable(subject))
 	if err != nil {
 		return nil, fmt.Errorf("failed to subscribe (%s): %w", subject, err)
 	}
@@ -59,20 +90,28 @@ func (n *Nats) Consume(ctx context.Context, subject string) (chan Message, error
 	go func() {
 		defer wg.Done()
 		for {
-			m, err := sub.NextMsg(time.Minute)
+			m, err := sub.NextMsgWithContext(ctx)
 			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
 				if errors.Is(err, nats.ErrTimeout) {
 					continue
 				}
 				panic(fmt.Sprintf("consume error: %v", err))
 			}
 
+			msg := Message{Value: string(m.Data), Partition: -1}
+			// JetStream metadata carries the time message was stored in the stream.
+			if meta, err := m.Metadata(); err == nil {
+				msg.Timestamp = &meta.Timestamp
+				msg.TimestampType = TimestampLogAppend
+			}
+
 			select {
 			case <-ctx.Done():
 				return
-			case ch <- Message{
-				Value: string(m.Data),
-			}:
+			case ch <- msg:
 			}
 
 			if err := m.Ack(); err != nil {
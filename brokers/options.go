@@ -0,0 +1,137 @@
+package brokers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Acknowledgement levels.
+const (
+	AcksNone   = "none"
+	AcksLeader = "leader"
+	AcksAll    = "all"
+)
+
+// Compression codecs.
+const (
+	CompressionNone   = "none"
+	CompressionGzip   = "gzip"
+	CompressionSnappy = "snappy"
+	CompressionLz4    = "lz4"
+	CompressionZstd   = "zstd"
+)
+
+// Options are producer tunables mapped onto each driver's own settings.
+// Zero batch sizes and max in-flight leave the client library default in place.
+type Options struct {
+	Acks        string        // none, leader or all
+	Compression string        // none, gzip, snappy, lz4 or zstd
+	Linger      time.Duration // How long to wait for more messages before sending a batch (0 - don't wait).
+	BatchSize   int           // Max messages in a batch.
+	BatchBytes  int           // Max batch size in bytes.
+	MaxInFlight int           // Max in-flight produce requests (per broker for Kafka).
+	Idempotent  bool          // Let the broker deduplicate producer retries.
+}
+
+// DefaultOptions returns options each driver used before they became configurable.
+func DefaultOptions(driver string) Options {
+	switch driver {
+	case "kafka":
+		return Options{
+			Acks:        AcksAll,
+			Compression: CompressionSnappy,
+			Linger:      time.Millisecond,
+			BatchSize:   100,
+		}
+	case "redpanda":
+		return Options{
+			Acks:        AcksAll,
+			Compression: CompressionSnappy,
+			Linger:      time.Millisecond,
+			Idempotent:  true, // Dropped with weaker acks unless set explicitly.
+		}
+	case "pulsar":
+		return Options{
+			Acks:        AcksAll,
+			Compression: CompressionNone,
+			Linger:      10 * time.Millisecond, // Client default batching delay.
+		}
+	}
+
+	return Options{
+		Acks:        AcksAll,
+		Compression: CompressionNone,
+	}
+}
+
+// Validate checks option values and whether the driver supports them.
+func (o Options) Validate(driver string) error {
+	switch o.Acks {
+	case AcksNone, AcksLeader, AcksAll:
+	default:
+		return fmt.Errorf("unknown acks level %q (want none, leader or all)", o.Acks)
+	}
+
+	switch o.Compression {
+	case CompressionNone, CompressionGzip, CompressionSnappy, CompressionLz4, CompressionZstd:
+	default:
+		return fmt.Errorf("unknown compression %q (want none, gzip, snappy, lz4 or zstd)", o.Compression)
+	}
+
+	if o.Linger < 0 || o.BatchSize < 0 || o.BatchBytes < 0 || o.MaxInFlight < 0 {
+		return fmt.Errorf("linger, batch size, batch bytes and max in-flight can't be negative")
+	}
+
+	var unsupported []string
+	switch driver {
+	case "kafka":
+		if o.MaxInFlight > 0 {
+			unsupported = append(unsupported, "max in-flight")
+		}
+		if o.Idempotent {
+			unsupported = append(unsupported, "idempotence")
+		}
+	case "redpanda":
+		if o.BatchSize > 0 {
+			unsupported = append(unsupported, "batch size (use batch bytes)")
+		}
+		if o.Idempotent && o.Acks != AcksAll {
+			return fmt.Errorf("idempotent producer requires all acks")
+		}
+	case "pulsar":
+		if o.Compression == CompressionSnappy {
+			unsupported = append(unsupported, "snappy compression")
+		}
+		if o.Idempotent {
+			unsupported = append(unsupported, "idempotence (enable broker deduplication instead)")
+		}
+	case "nats":
+		if o.Compression != CompressionNone {
+			unsupported = append(unsupported, "compression")
+		}
+		if o.Linger > 0 || o.BatchSize > 0 || o.BatchBytes > 0 {
+			unsupported = append(unsupported, "batching")
+		}
+		if o.MaxInFlight > 0 {
+			unsupported = append(unsupported, "max in-flight")
+		}
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("%s driver doesn't support %s", driver, strings.Join(unsupported, ", "))
+	}
+
+	return nil
+}
+
+func (o Options) String() string {
+	num := func(n int) string {
+		if n == 0 {
+			return "default"
+		}
+		return fmt.Sprint(n)
+	}
+
+	return fmt.Sprintf("acks=%s compression=%s linger=%v batch_size=%s batch_bytes=%s max_in_flight=%s idempotent=%t",
+		o.Acks, o.Compression, o.Linger, num(o.BatchSize), num(o.BatchBytes), num(o.MaxInFlight), o.Idempotent)
+}
@@ -4,81 +4,144 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"sync"
 
 	"github.com/apache/pulsar-client-go/pulsar"
 )
 
 type Pulsar struct {
-	cl pulsar.Client
-	p  pulsar.Producer
+	cl   pulsar.Client
+	p    pulsar.Producer
+	opts Options
 }
 
-func NewPulsar(url, topic string) (*Pulsar, error) {
+func NewPulsar(url, topic string, opts Options) (*Pulsar, error) {
 	cl, err := pulsar.NewClient(pulsar.ClientOptions{URL: url})
 	if err != nil {
 		return nil, err
 	}
 
-	var p pulsar.Producer
-	if topic != "" {
-		p, err = cl.CreateProducer(pulsar.ProducerOptions{
-			Topic: topic,
-		})
-		if err != nil {
-			return nil, err
-		}
+	return &Pulsar{cl: cl, opts: opts}, nil
+}
+
+var pulsarCompression = map[string]pulsar.CompressionType{
+	CompressionNone: pulsar.NoCompression,
+	CompressionGzip: pulsar.ZLib, // Same deflate algorithm.
+	CompressionLz4:  pulsar.LZ4,
+	CompressionZstd: pulsar.ZSTD,
+}
+
+// producer returns topic producer, creating it on first use
+// (Pulsar producers are bound to a single topic).
+func (p *Pulsar) producer(topic string) (pulsar.Producer, error) {
+	if p.p != nil && p.p.Topic() == topic {
+		return p.p, nil
+	}
+
+	po := pulsar.ProducerOptions{
+		Topic:                   topic,
+		CompressionType:         pulsarCompression[p.opts.Compression],
+		DisableBatching:         p.opts.Linger == 0,
+		BatchingMaxPublishDelay: p.opts.Linger,
+		BatchingMaxMessages:     uint(p.opts.BatchSize),
+		BatchingMaxSize:         uint(p.opts.BatchBytes),
+		MaxPendingMessages:      p.opts.MaxInFlight,
+	}
+	pr, err := p.cl.CreateProducer(po)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create producer: %w", err)
 	}
+	if p.p != nil {
+		p.p.Close()
+	}
+	p.p = pr
 
-	return &Pulsar{cl: cl, p: p}, nil
+	return pr, nil
+}
+
+// Close closes the producer and the client, a consumer closes its
+// subscription on Consume context cancel.
+func (p *Pulsar) Close() error {
+	if p.p != nil {
+		p.p.Close()
+	}
+	p.cl.Close()
+	return nil
 }
 
 func (p *Pulsar) Produce(ctx context.Context, topic, key, value string) error {
-	_, err := p.p.Send(ctx, &pulsar.ProducerMessage{
+	pr, err := p.producer(topic)
+	if err != nil {
+		return err
+	}
+
+	msg := &pulsar.ProducerMessage{
 		Payload: []byte(value),
 		Key:     key,
-	})
+	}
+	// Persistent topics always acknowledge writes, so "none" means not waiting for it.
+	if p.opts.Acks == AcksNone {
+		pr.SendAsync(ctx, msg, func(_ pulsar.MessageID, _ *pulsar.ProducerMessage, err error) {
+			if err != nil {
+				log.Printf("failed to send message: %v", err)
+			}
+		})
+		return nil
+	}
 
+	_, err = pr.Send(ctx, msg)
 	return err
 }
 
 func (p *Pulsar) Consume(ctx context.Context, topic string) (chan Message, error) {
 	ch := make(chan Message)
-	var c pulsar.Consumer
-	go func() {
-		<-ctx.Done()
-		close(ch)
-		p.p.Close()
-		p.cl.Close()
-		c.Close()
-	}()
-
 	c, err := p.cl.Subscribe(pulsar.ConsumerOptions{
 		Topic:            topic,
 		SubscriptionName: "test",
+		// Like Kafka consumer groups: one active consumer per partition.
+		Type: pulsar.Failover,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to subscribe: %w", err)
 	}
 
+	wg := sync.WaitGroup{}
+	wg.Add(1)
 	go func() {
+		<-ctx.Done()
+		wg.Wait()
+		close(ch)
+		c.Close()
+	}()
+
+	go func() {
+		defer wg.Done()
 		for {
 			m, err := c.Receive(ctx)
 			if err != nil {
 				if errors.Is(err, context.Canceled) {
-					continue
+					return
 				}
 				panic(fmt.Sprintf("consume error: %v", err))
 			}
 
-			ts := m.EventTime()
+			// Broker publish time is only available with broker entry metadata enabled,
+			// otherwise fall back to the producer set publish time.
+			ts, tsType := m.PublishTime(), TimestampCreate
+			if bts := m.BrokerPublishTime(); bts != nil {
+				ts, tsType = *bts, TimestampLogAppend
+			}
 
 			select {
 			case <-ctx.Done():
 				return
 			case ch <- Message{
-				Value:     string(m.Payload()),
-				Key:       m.Key(),
-				Timestamp: &ts,
+				Value:         string(m.Payload()),
+				Key:           m.Key(),
+				Partition:     m.ID().PartitionIdx(),
+				Timestamp:     &ts,
+				TimestampType: tsType,
 			}:
 			}
 
@@ -7,27 +7,36 @@ import (
 	"os"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/twmb/franz-go/pkg/kgo"
 )
 
 type RedPanda struct {
-	cl *kgo.Client
+	urls []string
+	cl   *kgo.Client
 }
 
-func NewRedPanda(url, topic string) (*RedPanda, error) {
-	rp := &RedPanda{}
+func NewRedPanda(url, topic string, o Options) (*RedPanda, error) {
+	rp := &RedPanda{urls: strings.Split(url, ",")}
 	opts := []kgo.Opt{
-		kgo.SeedBrokers(strings.Split(url, ",")...),
-		kgo.ProducerBatchCompression(kgo.SnappyCompression()),
-		kgo.RequiredAcks(kgo.AllISRAcks()),
-		kgo.ProducerLinger(time.Millisecond),
+		kgo.SeedBrokers(rp.urls...),
+		kgo.ProducerBatchCompression(franzCompression[o.Compression]),
+		kgo.RequiredAcks(franzAcks[o.Acks]),
+		kgo.ProducerLinger(o.Linger),
 		kgo.WithLogger(kgo.BasicLogger(os.Stderr, kgo.LogLevelWarn, nil)),
 		kgo.ConsumeResetOffset(kgo.NewOffset().AtEnd()),
 		kgo.ConsumerGroup("bench-franz"),
 		kgo.ConsumeTopics(topic),
 	}
+	if o.BatchBytes > 0 {
+		opts = append(opts, kgo.ProducerBatchMaxBytes(int32(o.BatchBytes)))
+	}
+	if o.MaxInFlight > 0 {
+		opts = append(opts, kgo.MaxProduceRequestsInflightPerBroker(o.MaxInFlight))
+	}
+	if !o.Idempotent {
+		opts = append(opts, kgo.DisableIdempotentWrite())
+	}
 
 	if topic != "" {
 		opts = append(opts, kgo.ConsumeTopics(strings.Split(topic, ",")...))
@@ -42,12 +51,41 @@ func NewRedPanda(url, topic string) (*RedPanda, error) {
 	return rp, nil
 }
 
+var franzAcks = map[string]kgo.Acks{
+	AcksNone:   kgo.NoAck(),
+	AcksLeader: kgo.LeaderAck(),
+	AcksAll:    kgo.AllISRAcks(),
+}
+
+var franzCompression = map[string]kgo.CompressionCodec{
+	CompressionNone:   kgo.NoCompression(),
+	CompressionGzip:   kgo.GzipCompression(),
+	CompressionSnappy: kgo.SnappyCompression(),
+	CompressionLz4:    kgo.Lz4Compression(),
+	CompressionZstd:   kgo.ZstdCompression(),
+}
+
+// ResetTopics deletes and recreates topics (Redpanda speaks Kafka admin protocol).
+func (rp *RedPanda) ResetTopics(ctx context.Context, topics []string) error {
+	return resetKafkaTopics(ctx, rp.urls, topics)
+}
+
+// Close closes the client, a consumer leaves its group: canceling Consume
+// context only stops polling.
+func (rp *RedPanda) Close() error {
+	rp.cl.Close()
+	return nil
+}
+
 func (rp *RedPanda) Produce(ctx context.Context, topic, key, value string) error {
 	msg := kgo.Record{
 		Topic: topic,
-		Key:   []byte(key),
 		Value: []byte(value),
 	}
+	// Records without key are spread by the sticky partitioner.
+	if key != "" {
+		msg.Key = []byte(key)
+	}
 
 	res := rp.cl.ProduceSync(ctx, &msg)
 
@@ -80,9 +118,11 @@ func (rp *RedPanda) Consume(ctx context.Context, topic string) (chan Message, er
 				case <-ctx.Done():
 					return
 				case ch <- Message{
-					Key:       string(m.Key),
-					Value:     string(m.Value),
-					Timestamp: &m.Timestamp,
+					Key:           string(m.Key),
+					Value:         string(m.Value),
+					Partition:     m.Partition,
+					Timestamp:     &m.Timestamp,
+					TimestampType: timestampType(m.Attrs),
 				}:
 				}
 			})
@@ -96,3 +136,13 @@ func (rp *RedPanda) Consume(ctx context.Context, topic string) (chan Message, er
 
 	return ch, nil
 }
+
+func timestampType(attrs kgo.RecordAttrs) TimestampType {
+	switch attrs.TimestampType() {
+	case 0:
+		return TimestampCreate
+	case 1:
+		return TimestampLogAppend
+	}
+	return TimestampUnknown
+}
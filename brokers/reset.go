@@ -0,0 +1,95 @@
+package brokers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// TopicResetter is implemented by drivers that can empty topics between runs.
+type TopicResetter interface {
+	ResetTopics(ctx context.Context, topics []string) error
+}
+
+// resetKafkaTopics deletes and recreates topics with the same partitions,
+// replication factor and topic level configs. Works for Redpanda as well.
+func resetKafkaTopics(ctx context.Context, urls []string, topics []string) error {
+	cl := &kafka.Client{Addr: kafka.TCP(urls...), Timeout: 30 * time.Second}
+	meta, err := cl.Metadata(ctx, &kafka.MetadataRequest{Topics: topics})
+	if err != nil {
+		return fmt.Errorf("failed to get topics metadata: %w", err)
+	}
+
+	configs := make([]kafka.TopicConfig, 0, len(topics))
+	for _, t := range meta.Topics {
+		if t.Error != nil {
+			return fmt.Errorf("topic %s: %w", t.Name, t.Error)
+		}
+		tc := kafka.TopicConfig{Topic: t.Name, NumPartitions: len(t.Partitions), ReplicationFactor: -1}
+		if len(t.Partitions) > 0 {
+			tc.ReplicationFactor = len(t.Partitions[0].Replicas)
+		}
+
+		resp, err := cl.DescribeConfigs(ctx, &kafka.DescribeConfigsRequest{
+			Resources: []kafka.DescribeConfigRequestResource{{
+				ResourceType: kafka.ResourceTypeTopic,
+				ResourceName: t.Name,
+			}},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to describe topic %s config: %w", t.Name, err)
+		}
+		for _, res := range resp.Resources {
+			for _, e := range res.ConfigEntries {
+				// Only configs set on the topic itself, others come from broker defaults.
+				if e.ConfigSource == 1 {
+					tc.ConfigEntries = append(tc.ConfigEntries, kafka.ConfigEntry{ConfigName: e.ConfigName, ConfigValue: e.ConfigValue})
+				}
+			}
+		}
+		configs = append(configs, tc)
+	}
+
+	del, err := cl.DeleteTopics(ctx, &kafka.DeleteTopicsRequest{Topics: topics})
+	if err != nil {
+		return fmt.Errorf("failed to delete topics: %w", err)
+	}
+	for topic, err := range del.Errors {
+		if err != nil {
+			return fmt.Errorf("failed to delete topic %s: %w", topic, err)
+		}
+	}
+
+	// Deletion completes asynchronously, retry until topics can be created again.
+	deadline := time.Now().Add(time.Minute)
+	for len(configs) > 0 {
+		resp, err := cl.CreateTopics(ctx, &kafka.CreateTopicsRequest{Topics: configs})
+		if err != nil {
+			return fmt.Errorf("failed to create topics: %w", err)
+		}
+		pending := configs[:0]
+		for _, tc := range configs {
+			err := resp.Errors[tc.Topic]
+			switch {
+			case err == nil:
+			case errors.Is(err, kafka.TopicAlreadyExists) && time.Now().Before(deadline):
+				pending = append(pending, tc)
+			default:
+				return fmt.Errorf("failed to create topic %s: %w", tc.Topic, err)
+			}
+		}
+		configs = pending
+		if len(configs) > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(500 * time.Millisecond):
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// clockSamples is the number of exchanges per clock measurement,
+// the one with the shortest round trip is the most accurate.
+const clockSamples = 8
+
+// ClockOffset is agent clock offset measured NTP-style by the coordinator.
+type ClockOffset struct {
+	Offset duration `json:"offset"` // Agent clock minus coordinator clock.
+	// Uncertainty is half of the round trip, the true offset is within ±Uncertainty.
+	Uncertainty duration `json:"uncertainty"`
+}
+
+// ClockSync tells how well agent timestamps agree with the coordinator clock.
+// Agents write envelope timestamps in coordinator time, so latency of
+// messages produced and consumed on different hosts is corrected.
+type ClockSync struct {
+	Before ClockOffset `json:"before"` // Used to correct timestamps.
+	After  ClockOffset `json:"after"`
+	// ErrorBound is the largest error of corrected timestamps:
+	// uncertainty of both measurements plus the drift between them.
+	ErrorBound duration `json:"error_bound"`
+}
+
+func newClockSync(before, after ClockOffset) *ClockSync {
+	drift := after.Offset - before.Offset
+	if drift < 0 {
+		drift = -drift
+	}
+	uncertainty := before.Uncertainty
+	if after.Uncertainty > uncertainty {
+		uncertainty = after.Uncertainty
+	}
+	return &ClockSync{Before: before, After: after, ErrorBound: drift + uncertainty}
+}
+
+// clockReply is agent side of a clock exchange.
+type clockReply struct {
+	Received int64 `json:"received"` // UnixNano
+	Sent     int64 `json:"sent"`     // UnixNano
+}
+
+// clock handles GET /clock.
+func (a *agent) clock(w http.ResponseWriter, r *http.Request) {
+	received := time.Now()
+	w.Header().Set("Content-Type", "application/json")
+	reply := clockReply{Received: received.UnixNano()}
+	reply.Sent = time.Now().UnixNano()
+	json.NewEncoder(w).Encode(reply)
+}
+
+// measureClock estimates agent clock offset, with t1 and t4 the coordinator
+// send and receive times and t2 and t3 the agent ones:
+// offset = ((t2-t1) + (t3-t4)) / 2, round trip = (t4-t1) - (t3-t2).
+func measureClock(ctx context.Context, url string) (ClockOffset, error) {
+	best := ClockOffset{Uncertainty: -1}
+	for i := 0; i < clockSamples; i++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/clock", nil)
+		if err != nil {
+			return best, err
+		}
+		t1 := time.Now()
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return best, err
+		}
+		var reply clockReply
+		err = json.NewDecoder(resp.Body).Decode(&reply)
+		t4 := time.Now()
+		resp.Body.Close()
+		if err != nil {
+			return best, fmt.Errorf("invalid clock reply: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return best, fmt.Errorf("clock exchange failed: %s", resp.Status)
+		}
+
+		t2, t3 := time.Unix(0, reply.Received), time.Unix(0, reply.Sent)
+		rtt := t4.Sub(t1) - t3.Sub(t2)
+		if best.Uncertainty < 0 || rtt/2 < time.Duration(best.Uncertainty) {
+			best = ClockOffset{
+				Offset:      duration((t2.Sub(t1) + t3.Sub(t4)) / 2),
+				Uncertainty: duration(rtt / 2),
+			}
+		}
+	}
+
+	return best, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// skewedClock serves clock exchanges of an agent whose clock is offset
+// ahead of the local one, and which takes hold to reply.
+func skewedClock(t *testing.T, offset, hold time.Duration) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reply := clockReply{Received: time.Now().Add(offset).UnixNano()}
+		time.Sleep(hold)
+		reply.Sent = time.Now().Add(offset).UnixNano()
+		json.NewEncoder(w).Encode(reply)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestMeasureClock(t *testing.T) {
+	for _, offset := range []time.Duration{0, 5 * time.Second, -90 * time.Minute} {
+		// Agent side time is not a part of the round trip.
+		c, err := measureClock(context.Background(), skewedClock(t, offset, 20*time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		u := time.Duration(c.Uncertainty)
+		if u < 0 || u > 10*time.Millisecond {
+			t.Errorf("offset %v: uncertainty %v, want round trip without agent time", offset, u)
+		}
+		if got := time.Duration(c.Offset); got < offset-u || got > offset+u {
+			t.Errorf("offset %v: measured %v ± %v", offset, got, u)
+		}
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not json"))
+	}))
+	defer srv.Close()
+	if _, err := measureClock(context.Background(), srv.URL); err == nil {
+		t.Errorf("invalid clock reply accepted")
+	}
+}
+
+func TestClockSync(t *testing.T) {
+	ms := func(n int) duration { return duration(time.Duration(n) * time.Millisecond) }
+	for _, tt := range []struct {
+		before, after ClockOffset
+		want          duration
+	}{
+		{ClockOffset{Offset: ms(100), Uncertainty: ms(1)}, ClockOffset{Offset: ms(100), Uncertainty: ms(1)}, ms(1)},
+		{ClockOffset{Offset: ms(100), Uncertainty: ms(1)}, ClockOffset{Offset: ms(103), Uncertainty: ms(2)}, ms(5)},
+		{ClockOffset{Offset: ms(100), Uncertainty: ms(3)}, ClockOffset{Offset: ms(96), Uncertainty: ms(1)}, ms(7)},
+	} {
+		if got := newClockSync(tt.before, tt.after).ErrorBound; got != tt.want {
+			t.Errorf("before %+v, after %+v: error bound %v, want %v", tt.before, tt.after, time.Duration(got), time.Duration(tt.want))
+		}
+	}
+}
+
+func TestClockReference(t *testing.T) {
+	// Agent clock is 5s ahead, envelopes travel in coordinator time.
+	cfg := Config{ClockOffset: 5 * time.Second}
+	local := Envelope{IntendedAt: int64(10 * time.Second), SentAt: int64(11 * time.Second)}
+	ref := cfg.toReference(local)
+	if ref.IntendedAt != int64(5*time.Second) || ref.SentAt != int64(6*time.Second) {
+		t.Errorf("reference time %+v, want 5s behind", ref)
+	}
+	other := Config{ClockOffset: -2 * time.Second}
+	if got := other.fromReference(ref); got.SentAt != int64(4*time.Second) {
+		t.Errorf("sent at %v on the other agent, want 4s", time.Duration(got.SentAt))
+	}
+	if got := cfg.fromReference(ref); got.IntendedAt != local.IntendedAt || got.SentAt != local.SentAt {
+		t.Errorf("round trip %+v, want %+v", got, local)
+	}
+}
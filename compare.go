@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Comparison verdicts.
+const (
+	verdictImprovement = "improvement"
+	verdictRegression  = "regression"
+	verdictNoise       = "noise" // Not significant or too small to matter.
+	verdictSame        = "same"  // Exact counters that didn't change.
+)
+
+// comparison is a metric of candidate result compared to base one.
+type comparison struct {
+	Metric    string
+	Format    string // Value format, e.g. "%.2f".
+	Base      float64
+	Candidate float64
+	Test      string // How significance was tested.
+	Verdict   string
+}
+
+// compareOptions tell what difference is significant.
+type compareOptions struct {
+	alpha     float64 // Significance level of Mann-Whitney test.
+	minChange float64 // Smaller relative changes are noise even if significant.
+}
+
+// runCompare implements "compare" command.
+func runCompare(args []string) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	var opts compareOptions
+	fs.Float64Var(&opts.alpha, "alpha", 0.05, "significance level of Mann-Whitney test of latency distributions")
+	fs.Float64Var(&opts.minChange, "min_change", 0.01, "relative change below which a significant difference is still noise")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s compare [flags] BASE_RESULT RESULT...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if opts.alpha <= 0 || opts.alpha >= 1 {
+		log.Fatal("-alpha must be in (0, 1) range")
+	}
+
+	results := make([]Result, fs.NArg())
+	for i, path := range fs.Args() {
+		var err error
+		if results[i], err = readResult(path); err != nil {
+			log.Fatalf("Invalid result: %v", err)
+		}
+	}
+
+	base := results[0]
+	for i, res := range results[1:] {
+		fmt.Printf("Comparing %s (run %s) to base %s (run %s)\n", fs.Arg(i+1), res.RunID, fs.Arg(0), base.RunID)
+		if diff := scenarioDiff(base.Scenario, res.Scenario); len(diff) > 0 {
+			fmt.Printf("Scenarios differ in: %s\n", strings.Join(diff, ", "))
+		}
+		printComparisons(os.Stdout, compareResults(base, res, opts))
+		fmt.Println()
+	}
+}
+
+// compareResults lines up metrics of candidate result with base one.
+//
+// Percentiles and throughput are significantly different when their
+// confidence intervals don't overlap, latency distributions shift when
+// Mann-Whitney test rejects they are the same. Error counters are exact.
+// Metrics without a test only need to change by more than minChange,
+// max latency is a single value and always noise.
+func compareResults(base, cand Result, opts compareOptions) []comparison {
+	var rows []comparison
+	add := func(metric, format string, b, c float64, higherBetter bool, test string, significant bool) {
+		rows = append(rows, comparison{Metric: metric, Format: format, Base: b, Candidate: c, Test: test,
+			Verdict: verdict(b, c, higherBetter, significant, opts.minChange)})
+	}
+
+	if b, c := base.MeasuredThroughput, cand.MeasuredThroughput; b != nil && c != nil {
+		add("Throughput (measured), msg/s", "%.2f", b.Mean, c.Mean, true, "CI overlap", !overlap(b.CI, c.CI))
+	} else {
+		add("Throughput, msg/s", "%.2f", base.Throughput, cand.Throughput, true, "none", true)
+	}
+	if base.Role != roleConsume && cand.Role != roleConsume {
+		add("Produce throughput, msg/s", "%.2f", base.ProduceThroughput, cand.ProduceThroughput, true, "none", true)
+	}
+	add("Data throughput, MiB/s", "%.3f", base.DataThroughput, cand.DataThroughput, true, "none", true)
+
+	latency := func(kind string, b, c Percentiles, bh, ch *Histogram) {
+		if b.Count == 0 || c.Count == 0 {
+			return
+		}
+		add(kind+" mean, ms", "%.3f", b.Mean, c.Mean, false, "none", true)
+		// Shift is told by the test, its size by the change of the mean.
+		if u, err := mannWhitney(bh, ch); err == nil {
+			add(kind+" distribution shift (mean), ms", "%.3f", b.Mean, c.Mean, false, fmt.Sprintf("Mann-Whitney p=%.3g", u.p), u.p < opts.alpha)
+		}
+		var bci, cci PercentileCI
+		if b.CI != nil && c.CI != nil {
+			bci, cci = *b.CI, *c.CI
+		}
+		for _, p := range []struct {
+			name     string
+			b, c     float64
+			bci, cci ConfidenceInterval
+		}{
+			{"P50", b.P50, c.P50, bci.P50, cci.P50},
+			{"P90", b.P90, c.P90, bci.P90, cci.P90},
+			{"P99", b.P99, c.P99, bci.P99, cci.P99},
+			{"P99.9", b.P999, c.P999, bci.P999, cci.P999},
+		} {
+			if b.CI == nil || c.CI == nil {
+				add(kind+" "+p.name+", ms", "%.3f", p.b, p.c, false, "none", true)
+				continue
+			}
+			add(kind+" "+p.name+", ms", "%.3f", p.b, p.c, false, "CI overlap", !overlap(p.bci, p.cci))
+		}
+		add(kind+" max, ms", "%.3f", b.Max, c.Max, false, "single value", false)
+	}
+	bl, cl := base.Latencies, cand.Latencies
+	latency("Latency", base.Percentiles.Latency, cand.Percentiles.Latency, bl.Latency, cl.Latency)
+	latency("Corrected latency", base.Percentiles.Corrected, cand.Percentiles.Corrected, bl.Corrected, cl.Corrected)
+	latency("Ack latency", base.Percentiles.Ack, cand.Percentiles.Ack, bl.Ack, cl.Ack)
+
+	exact := func(metric string, b, c uint64) {
+		add(metric, "%.0f", float64(b), float64(c), false, "exact", true)
+	}
+	exact("Produce failed", base.Errors.ProduceFailed, cand.Errors.ProduceFailed)
+	exact("Missing", base.Errors.Missing, cand.Errors.Missing)
+	exact("Duplicated", base.Errors.Duplicated, cand.Errors.Duplicated)
+	exact("Drain timeouts", uint64(base.Errors.DrainTimeouts), uint64(cand.Errors.DrainTimeouts))
+
+	// Topics both results have.
+	topics := make(map[string]TopicSummary)
+	for _, t := range base.Topics {
+		topics[t.Topic] = t
+	}
+	for _, c := range cand.Topics {
+		b, ok := topics[c.Topic]
+		if !ok {
+			continue
+		}
+		add("Topic "+c.Topic+" throughput, msg/s", "%.2f", b.Throughput, c.Throughput, true, "none", true)
+		bp, cp := b.Percentiles.Latency, c.Percentiles.Latency
+		if bp.Count > 0 && cp.Count > 0 && bp.CI != nil && cp.CI != nil {
+			add("Topic "+c.Topic+" P99, ms", "%.3f", bp.P99, cp.P99, false, "CI overlap", !overlap(bp.CI.P99, cp.CI.P99))
+		}
+	}
+
+	return rows
+}
+
+// verdict classifies change from base to candidate value.
+func verdict(base, cand float64, higherBetter, significant bool, minChange float64) string {
+	if base == cand {
+		return verdictSame
+	}
+	if !significant || base != 0 && math.Abs(cand-base)/math.Abs(base) < minChange {
+		return verdictNoise
+	}
+	if (cand > base) == higherBetter {
+		return verdictImprovement
+	}
+	return verdictRegression
+}
+
+// overlap reports whether confidence intervals overlap.
+func overlap(a, b ConfidenceInterval) bool {
+	return a.Low <= b.High && b.Low <= a.High
+}
+
+// mannWhitneyResult is Mann-Whitney U test of two samples.
+type mannWhitneyResult struct {
+	u float64 // U statistic of the first sample.
+	z float64 // Normal approximation, positive if the first sample tends to be larger.
+	p float64 // Two-sided p-value.
+}
+
+// mannWhitney runs Mann-Whitney U test on values of two histograms.
+// Values of the same bucket are ties, so histograms must have the same
+// precision. Normal approximation with tie correction is used, samples
+// are large.
+func mannWhitney(a, b *Histogram) (mannWhitneyResult, error) {
+	var res mannWhitneyResult
+	if a.precision != b.precision || len(a.counts) != len(b.counts) {
+		return res, fmt.Errorf("can't compare histograms with different precision (%d and %d)", a.precision, b.precision)
+	}
+	na, nb := float64(a.total), float64(b.total)
+	if na == 0 || nb == 0 {
+		return res, fmt.Errorf("no values to compare")
+	}
+
+	var seen, rankSum, ties float64
+	for i := range a.counts {
+		ca, cb := float64(a.counts[i]), float64(b.counts[i])
+		t := ca + cb
+		if t == 0 {
+			continue
+		}
+		rankSum += ca * (seen + (t+1)/2) // Ties get the mean of their ranks.
+		ties += t*t*t - t
+		seen += t
+	}
+
+	n := na + nb
+	res.u = rankSum - na*(na+1)/2
+	mean := na * nb / 2
+	variance := na * nb / 12 * ((n + 1) - ties/(n*(n-1)))
+	if variance <= 0 {
+		res.p = 1 // All values are ties.
+		return res, nil
+	}
+	res.z = (res.u - mean) / math.Sqrt(variance)
+	res.p = math.Erfc(math.Abs(res.z) / math.Sqrt2)
+	return res, nil
+}
+
+// scenarioDiff returns top level scenario fields that differ.
+func scenarioDiff(a, b *Scenario) []string {
+	fields := func(s *Scenario) map[string]json.RawMessage {
+		m := make(map[string]json.RawMessage)
+		if raw, err := json.Marshal(s); err == nil {
+			json.Unmarshal(raw, &m)
+		}
+		return m
+	}
+	fa, fb := fields(a), fields(b)
+	var diff []string
+	for k, v := range fa {
+		if !bytes.Equal(v, fb[k]) {
+			diff = append(diff, k)
+		}
+	}
+	for k := range fb {
+		if _, ok := fa[k]; !ok {
+			diff = append(diff, k)
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+// printComparisons prints a row per compared metric.
+func printComparisons(out io.Writer, rows []comparison) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Metric\tBase\tCandidate\tDelta\tChange\tTest\tVerdict\t")
+	for _, r := range rows {
+		change := "-"
+		if r.Base != 0 {
+			change = fmt.Sprintf("%+.1f%%", 100*(r.Candidate-r.Base)/r.Base)
+		}
+		fmt.Fprintf(w, "%s\t"+r.Format+"\t"+r.Format+"\t%+"+r.Format[1:]+"\t%s\t%s\t%s\t\n",
+			r.Metric, r.Base, r.Candidate, r.Candidate-r.Base, change, r.Test, r.Verdict)
+	}
+	w.Flush()
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+// histogramOf records values in microseconds, below 2048 they are exact at precision 3.
+func histogramOf(values ...int64) *Histogram {
+	h := NewHistogram(3)
+	for _, v := range values {
+		h.RecordValue(v, 1)
+	}
+	return h
+}
+
+// mannWhitneyExact computes U statistic by comparing all pairs, and z
+// with tie corrected variance.
+func mannWhitneyExact(a, b []int64) (u, z float64) {
+	ties := make(map[int64]float64)
+	for _, x := range a {
+		ties[x]++
+		for _, y := range b {
+			switch {
+			case x > y:
+				u++
+			case x == y:
+				u += 0.5
+			}
+		}
+	}
+	for _, y := range b {
+		ties[y]++
+	}
+	na, nb := float64(len(a)), float64(len(b))
+	n := na + nb
+	var t3 float64
+	for _, t := range ties {
+		t3 += t*t*t - t
+	}
+	variance := na * nb / 12 * (n + 1 - t3/(n*(n-1)))
+	return u, (u - na*nb/2) / math.Sqrt(variance)
+}
+
+func TestMannWhitney(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		a, b []int64
+	}{
+		{"no ties", []int64{1, 3, 5, 7}, []int64{2, 4, 6, 8, 10}},
+		{"ties", []int64{1, 2, 2, 3}, []int64{2, 3, 3, 4}},
+		{"ties across samples", []int64{5, 5, 5, 6, 7}, []int64{5, 5, 6, 6, 6, 9}},
+		{"first larger", []int64{10, 11, 11, 12, 12, 12}, []int64{1, 2, 2, 10}},
+		{"identical", []int64{1, 2, 2, 3}, []int64{1, 2, 2, 3}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := mannWhitney(histogramOf(tt.a...), histogramOf(tt.b...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			u, z := mannWhitneyExact(tt.a, tt.b)
+			if res.u != u || math.Abs(res.z-z) > 1e-9 {
+				t.Errorf("got U %v, z %v, want U %v, z %v", res.u, res.z, u, z)
+			}
+			if p := math.Erfc(math.Abs(z) / math.Sqrt2); math.Abs(res.p-p) > 1e-9 {
+				t.Errorf("got p %v, want %v", res.p, p)
+			}
+		})
+	}
+}
+
+func TestMannWhitneySignificance(t *testing.T) {
+	sample := func(shift int64) *Histogram {
+		h := NewHistogram(3)
+		for _, v := range latencySample(1, 2000) {
+			h.RecordValue(v+shift, 1)
+		}
+		return h
+	}
+	base := sample(0)
+
+	same, err := mannWhitney(base, sample(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same.z != 0 || same.p != 1 {
+		t.Errorf("identical samples: got z %v, p %v, want 0 and 1", same.z, same.p)
+	}
+
+	slower, err := mannWhitney(base, sample(int64(time.Millisecond/time.Microsecond)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slower.z >= 0 || slower.p > 1e-6 {
+		t.Errorf("shifted samples: got z %v, p %v, want negative z and tiny p", slower.z, slower.p)
+	}
+
+	ties, err := mannWhitney(histogramOf(7, 7, 7), histogramOf(7, 7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ties.p != 1 {
+		t.Errorf("all ties: got p %v, want 1", ties.p)
+	}
+
+	if _, err := mannWhitney(base, NewHistogram(2)); err == nil {
+		t.Errorf("compared histograms of different precision")
+	}
+	if _, err := mannWhitney(base, NewHistogram(3)); err == nil {
+		t.Errorf("compared to empty histogram")
+	}
+}
+
+func TestVerdict(t *testing.T) {
+	for _, tt := range []struct {
+		base, cand   float64
+		higherBetter bool
+		significant  bool
+		want         string
+	}{
+		{100, 100, true, true, verdictSame},
+		{100, 120, true, true, verdictImprovement},
+		{100, 120, false, true, verdictRegression},
+		{100, 80, false, true, verdictImprovement},
+		{100, 120, true, false, verdictNoise},
+		{100, 100.5, true, true, verdictNoise}, // Below minimal change.
+		{0, 1, false, true, verdictRegression},
+	} {
+		if got := verdict(tt.base, tt.cand, tt.higherBetter, tt.significant, 0.01); got != tt.want {
+			t.Errorf("verdict(%v, %v, %v, %v) = %s, want %s", tt.base, tt.cand, tt.higherBetter, tt.significant, got, tt.want)
+		}
+	}
+}
+
+func TestCompareDistributionShift(t *testing.T) {
+	result := func(scale float64) Result {
+		r := Result{Latencies: newProducerLatencies(3)}
+		// Narrow distribution, so that a small shift is significant.
+		for v := 10000; v < 11000; v++ {
+			r.Latencies.Latency.RecordValue(int64(float64(v)*scale), 100)
+		}
+		r.Percentiles = newLatencyPercentiles(r.Latencies)
+		return r
+	}
+	base := result(1)
+	for _, tt := range []struct {
+		name  string
+		scale float64
+		want  string
+	}{
+		{"same", 1, verdictSame},
+		{"below minimal change", 1.008, verdictNoise},
+		{"slower", 1.2, verdictRegression},
+		{"faster", 0.8, verdictImprovement},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var shift, mean *comparison
+			rows := compareResults(base, result(tt.scale), compareOptions{alpha: 0.05, minChange: 0.01})
+			for i, r := range rows {
+				switch r.Metric {
+				case "Latency distribution shift (mean), ms":
+					shift = &rows[i]
+				case "Latency mean, ms":
+					mean = &rows[i]
+				}
+			}
+			if shift == nil || mean == nil {
+				t.Fatalf("no distribution shift or mean rows in %+v", rows)
+			}
+			var p float64
+			if _, err := fmt.Sscanf(shift.Test, "Mann-Whitney p=%g", &p); err != nil {
+				t.Fatalf("shift: test %q: %v", shift.Test, err)
+			}
+			if tt.scale != 1 && p >= 0.05 {
+				t.Errorf("shift: got p %v, want significant", p)
+			}
+			if shift.Verdict != tt.want {
+				t.Errorf("shift: got %s, want %s", shift.Verdict, tt.want)
+			}
+			if mean.Test != "none" {
+				t.Errorf("mean: got test %s, want none", mean.Test)
+			}
+		})
+	}
+}
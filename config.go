@@ -0,0 +1,102 @@
+package main
+
+import (
+	"time"
+
+	"streambench/brokers"
+)
+
+// Config describes a single benchmark run.
+type Config struct {
+	Role     string // What this process runs: produce, consume or both.
+	Driver   string
+	Options  brokers.Options
+	Brokers  string
+	Payload  PayloadConfig
+	Groups   []TopicGroup
+	Messages int           // Number of messages per producer (0 - unlimited).
+	Duration time.Duration // Production time limit (0 - unlimited).
+	Warmup   time.Duration // Excluded from measurement at the start (legacyWarmup - first and last 10%).
+	Cooldown time.Duration // Excluded from measurement at the end of production (needs Duration).
+	Steady   *SteadyState  // Detect steady state after warmup and only measure it (optional).
+	Drain    time.Duration // Max time to wait for in-flight messages after producers stop.
+	Interval time.Duration // Time series interval.
+
+	// ClockOffset is local clock minus reference clock, envelope timestamps
+	// are in reference time so that hosts with different clocks agree on them.
+	ClockOffset time.Duration
+
+	Precision  int            // Latency histogram significant digits.
+	ResultFile string         // Where to write JSON result document (empty - don't write).
+	SeriesFile string         // Where to write time series CSV (empty - don't write).
+	Scenario   *Scenario      // Resolved scenario embedded into results.
+	Progress   func(Progress) // Called every second while the run goes (optional).
+
+	Assertions []assertion // Checked against the result (optional).
+	Baseline   *Result     // Result "baseline" assertions compare to (optional).
+}
+
+// Process roles, producers and consumers of a run may be on different hosts.
+const (
+	roleBoth    = "both"
+	roleProduce = "produce"
+	roleConsume = "consume"
+)
+
+// legacyWarmup excludes first and last 10% of the run from measurement.
+const legacyWarmup = -1
+
+// Measurement window modes, see MeasureWindow.
+const (
+	windowLegacy = "legacy" // First and last 10% of the run.
+	windowFixed  = "fixed"  // Warmup and cooldown.
+	windowSteady = "steady" // Detected steady state and cooldown.
+)
+
+// window describes measurement window, without steady state detection result.
+func (cfg Config) window() MeasureWindow {
+	switch {
+	case cfg.Steady != nil:
+		return MeasureWindow{Mode: windowSteady, Warmup: duration(cfg.Warmup), Cooldown: duration(cfg.Cooldown), Steady: cfg.Steady}
+	case cfg.Warmup >= 0:
+		return MeasureWindow{Mode: windowFixed, Warmup: duration(cfg.Warmup), Cooldown: duration(cfg.Cooldown)}
+	}
+	return MeasureWindow{Mode: windowLegacy}
+}
+
+// toReference converts envelope timestamps from local to reference time.
+func (cfg Config) toReference(e Envelope) Envelope {
+	e.IntendedAt -= int64(cfg.ClockOffset)
+	e.SentAt -= int64(cfg.ClockOffset)
+	return e
+}
+
+// fromReference converts envelope timestamps from reference to local time.
+func (cfg Config) fromReference(e Envelope) Envelope {
+	e.IntendedAt += int64(cfg.ClockOffset)
+	e.SentAt += int64(cfg.ClockOffset)
+	return e
+}
+
+// measured reports whether message falls into the measurement window.
+// Without explicit warmup first and last 10% of the run (by message count or
+// by time) are excluded to account for broker "warm up" time and shutdown part
+// (some producers can finish earlier than others that will make tail of the
+// latencies more sparse). Steady state is checked separately, see seriesRecorder.
+func (cfg Config) measured(e Envelope, start time.Time) bool {
+	sent := time.Unix(0, e.IntendedAt)
+	if cfg.Warmup >= 0 {
+		if sent.Before(start.Add(cfg.Warmup)) {
+			return false
+		}
+		return cfg.Cooldown == 0 || sent.Before(start.Add(cfg.Duration-cfg.Cooldown))
+	}
+
+	if cfg.Messages > 0 {
+		cut := uint64(cfg.Messages / 10)
+		return e.Seq >= cut && e.Seq < uint64(cfg.Messages)-cut
+	}
+
+	cut := cfg.Duration / 10
+	return !sent.Before(start.Add(cut)) && sent.Before(start.Add(cfg.Duration-cut))
+}
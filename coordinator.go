@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// consumerLead is how much earlier consume only agents start,
+// they skip messages produced before they started.
+const consumerLead = time.Second
+
+// Cluster is a run spread over several agents.
+type Cluster struct {
+	Scenario   string         `json:"scenario"`              // Scenario file, relative to the cluster file.
+	StartDelay duration       `json:"start_delay,omitempty"` // Time agents get to prepare, 5s by default.
+	Agents     []clusterAgent `json:"agents"`
+}
+
+// clusterAgent is an agent and its part of the scenario.
+type clusterAgent struct {
+	Name    string   `json:"name,omitempty"` // Names result file, agentN by default.
+	URL     string   `json:"url"`
+	Role    string   `json:"role,omitempty"`    // both (default), produce or consume.
+	Brokers []string `json:"brokers,omitempty"` // Overrides scenario brokers.
+	Topics  []string `json:"topics,omitempty"`  // Overrides topics of a single group scenario.
+}
+
+// runCoordinate implements "coordinate" command.
+func runCoordinate(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("coordinate", flag.ExitOnError)
+	out := fs.String("out", ".", "directory to write agent result documents to")
+	precision := fs.Int("hist_precision", defaultPrecision, "latency histogram precision (significant decimal digits, 1-3), each histogram takes about 188KB at 3")
+	maxClockError := fs.Duration("max_clock_error", time.Millisecond, "refuse to run producers and consumers on different agents if agent clock offset is not known within this bound")
+	baselineFile := fs.String("baseline", "", "result document to compare the merged result to, see -baseline of a single run")
+	tolerance := fs.Float64("baseline_tolerance", 0.05, "relative throughput and latency change allowed by default -baseline checks")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s coordinate [flags] CLUSTER_FILE\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *precision < 1 || *precision > maxPrecision {
+		log.Fatalf("-hist_precision must be in 1..%d range", maxPrecision)
+	}
+
+	cluster, reqs, err := loadCluster(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Invalid cluster: %v", err)
+	}
+	// Assertions are checked against results of all agents merged.
+	asserts := reqs[0].Scenario.assertions()
+	var baseline *Result
+	if *baselineFile != "" {
+		if baseline, asserts, err = loadBaseline(*baselineFile, *tolerance, asserts); err != nil {
+			log.Fatalf("Invalid baseline: %v", err)
+		}
+	}
+
+	// Messages produced and consumed by different agents need agreeing clocks.
+	crossAgent := false
+	for _, req := range reqs {
+		crossAgent = crossAgent || req.Role != roleBoth
+	}
+	before, err := measureClocks(ctx, cluster.Agents)
+	if err != nil {
+		log.Fatalf("Clock sync failed: %v", err)
+	}
+	for i, a := range cluster.Agents {
+		c := before[i]
+		log.Printf("Agent %s clock offset %v ± %v", a.Name, time.Duration(c.Offset), time.Duration(c.Uncertainty))
+		if crossAgent && time.Duration(c.Uncertainty) > *maxClockError {
+			log.Fatalf("Agent %s clock offset is only known within ±%v (-max_clock_error is %v), latency of messages crossing agents would be unreliable",
+				a.Name, time.Duration(c.Uncertainty), *maxClockError)
+		}
+		reqs[i].ClockOffset = c.Offset
+	}
+
+	// Consumers running apart from producers start first.
+	startAt := time.Now().Add(time.Duration(cluster.StartDelay))
+	lead := time.Duration(0)
+	for _, req := range reqs {
+		if req.Role == roleConsume {
+			lead = consumerLead
+		}
+	}
+	for i := range reqs {
+		reqs[i].Precision = *precision
+		reqs[i].StartAt = startAt
+		if reqs[i].Role != roleConsume {
+			reqs[i].StartAt = startAt.Add(lead)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make([]Result, len(reqs))
+	var (
+		mu       sync.Mutex
+		failed   string
+		firstErr error
+	)
+	wg := sync.WaitGroup{}
+	for i, a := range cluster.Agents {
+		wg.Add(1)
+		go func(i int, a clusterAgent) {
+			defer wg.Done()
+			accepted := false
+			res, err := postRun(ctx, a.URL, reqs[i], func(e agentEvent) {
+				if !accepted {
+					accepted = true
+					log.Printf("Agent %s accepted the run (%s)", a.Name, reqs[i].Role)
+				}
+				if e.Progress != nil {
+					log.Printf("Agent %s: %v", a.Name, e.Progress)
+				}
+			})
+			if err != nil {
+				mu.Lock()
+				defer mu.Unlock()
+				// Other agents fail once canceled, the first error is the cause.
+				if firstErr == nil {
+					failed, firstErr = a.Name, err
+					cancel()
+				}
+				return
+			}
+			log.Printf("Agent %s finished", a.Name)
+			results[i] = res
+		}(i, a)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		log.Fatalf("Run failed on agent %s: %v", failed, firstErr)
+	}
+
+	after, err := measureClocks(ctx, cluster.Agents)
+	if err != nil {
+		log.Printf("Clock sync after the run failed, clock drift is unknown: %v", err)
+		after = before
+	}
+	for i := range results {
+		results[i].Clock = newClockSync(before[i], after[i])
+	}
+	if crossAgent {
+		checkClockError(cluster.Agents, results)
+	}
+
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		log.Fatalf("failed to create result directory: %v", err)
+	}
+	for i, a := range cluster.Agents {
+		if err := writeResult(filepath.Join(*out, a.Name+".result.json"), results[i]); err != nil {
+			log.Fatalf("failed to write result: %v", err)
+		}
+		if s := results[i].Series; s != nil {
+			if err := writeSeries(filepath.Join(*out, a.Name+".series.csv"), s); err != nil {
+				log.Fatalf("failed to write time series: %v", err)
+			}
+		}
+	}
+	printCluster(os.Stdout, cluster.Agents, results)
+
+	if len(asserts) == 0 {
+		return
+	}
+	names := make([]string, len(cluster.Agents))
+	for i, a := range cluster.Agents {
+		names[i] = a.Name
+	}
+	merged, err := mergeResults(names, results)
+	if err != nil {
+		log.Fatalf("Merge failed, can't check assertions: %v", err)
+	}
+	merged.Assertions = evaluateAssertions(asserts, merged, baseline)
+	printAssertions(os.Stdout, merged.Assertions)
+	if !assertionsPassed(merged.Assertions) {
+		log.Fatal("Assertions failed")
+	}
+}
+
+// loadCluster reads cluster file and returns run requests of all agents,
+// so an invalid fragment is reported before any agent starts.
+func loadCluster(path string) (Cluster, []agentRequest, error) {
+	var c Cluster
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return c, nil, fmt.Errorf("failed to read cluster: %w", err)
+	}
+	if err := decodeStrict(path, b, &c); err != nil {
+		return c, nil, err
+	}
+
+	if c.Scenario == "" {
+		return c, nil, fmt.Errorf("scenario: scenario file required")
+	}
+	c.Scenario = relativeTo(path, c.Scenario)
+	base, err := loadScenario(c.Scenario)
+	if err != nil {
+		return c, nil, err
+	}
+	if c.StartDelay < 0 {
+		return c, nil, fmt.Errorf("start_delay: can't be negative")
+	}
+	if c.StartDelay == 0 {
+		c.StartDelay = duration(5 * time.Second)
+	}
+	if len(c.Agents) == 0 {
+		return c, nil, fmt.Errorf("agents: at least one agent required")
+	}
+
+	reqs := make([]agentRequest, len(c.Agents))
+	names := make(map[string]bool)
+	for i := range c.Agents {
+		a := &c.Agents[i]
+		if a.Name == "" {
+			a.Name = fmt.Sprintf("agent%d", i)
+		}
+		if names[a.Name] {
+			return c, nil, fmt.Errorf("agents[%d].name: %s is already used", i, a.Name)
+		}
+		names[a.Name] = true
+		if a.URL == "" {
+			return c, nil, fmt.Errorf("agents[%d].url: agent url required", i)
+		}
+		switch a.Role {
+		case "":
+			a.Role = roleBoth
+		case roleBoth, roleProduce, roleConsume:
+		default:
+			return c, nil, fmt.Errorf("agents[%d].role: unknown role %q (want both, produce or consume)", i, a.Role)
+		}
+
+		s := base
+		s.Groups = append([]TopicGroup(nil), base.Groups...)
+		if len(a.Brokers) > 0 {
+			s.Brokers = a.Brokers
+		}
+		if len(a.Topics) > 0 {
+			if len(s.Groups) != 1 {
+				return c, nil, fmt.Errorf("agents[%d].topics: can only override scenario with a single topic group, %s has %d", i, c.Scenario, len(s.Groups))
+			}
+			s.Groups[0].Topics = a.Topics
+		}
+		if err := s.resolve(); err != nil {
+			return c, nil, fmt.Errorf("agents[%d]: %w", i, err)
+		}
+		reqs[i] = agentRequest{Scenario: s, Role: a.Role}
+	}
+
+	return c, reqs, nil
+}
+
+// measureClocks measures clock offset of every agent, one at a time
+// so that exchanges don't compete.
+func measureClocks(ctx context.Context, agents []clusterAgent) ([]ClockOffset, error) {
+	offsets := make([]ClockOffset, len(agents))
+	for i, a := range agents {
+		var err error
+		if offsets[i], err = measureClock(ctx, a.URL); err != nil {
+			return nil, fmt.Errorf("agent %s: %w", a.Name, err)
+		}
+	}
+	return offsets, nil
+}
+
+// checkClockError warns when latency of messages produced and consumed on
+// different agents is not larger than timestamp error of these agents.
+func checkClockError(agents []clusterAgent, results []Result) {
+	var produceErr, consumeErr duration
+	for i, res := range results {
+		switch {
+		case agents[i].Role == roleProduce && res.Clock.ErrorBound > produceErr:
+			produceErr = res.Clock.ErrorBound
+		case agents[i].Role == roleConsume && res.Clock.ErrorBound > consumeErr:
+			consumeErr = res.Clock.ErrorBound
+		}
+	}
+	bound := time.Duration(produceErr + consumeErr)
+	log.Printf("Latency error bound of messages crossing agents: ±%v", bound)
+	for i, res := range results {
+		p50 := time.Duration(res.Percentiles.Latency.P50 * float64(time.Millisecond))
+		if agents[i].Role == roleConsume && res.Percentiles.Latency.Count > 0 && p50 <= bound {
+			log.Printf("WARNING: agent %s P50 latency %v is within clock error bound ±%v, its latencies are unreliable", agents[i].Name, p50, bound)
+		}
+	}
+}
+
+// printCluster prints a row per agent.
+func printCluster(out io.Writer, agents []clusterAgent, results []Result) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Agent\tRole\tRun ID\tProduced\tConsumed\tMessages/sec\tP50\tP99\tMax\tMissing\tDrain\t")
+	for i, a := range agents {
+		res := results[i]
+		p := res.Percentiles.Latency
+		drain := time.Duration(res.DrainTime).Round(time.Millisecond).String()
+		if !res.Drained {
+			drain += " (timeout)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%.2f\t%s\t%s\t%s\t%d\t%s\t\n", a.Name, res.Role, res.RunID, res.Produced, res.Consumed,
+			res.Throughput, ms(p.P50), ms(p.P99), ms(p.Max), res.Errors.Missing, drain)
+	}
+	w.Flush()
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"streambench/brokers"
+)
+
+// coordinateEnv makes the test binary run "coordinate" command with
+// arguments it holds (newline separated) instead of tests, so that the
+// exit status of the command can be checked.
+const coordinateEnv = "STREAMBENCH_TEST_COORDINATE"
+
+func TestMain(m *testing.M) {
+	if args := os.Getenv(coordinateEnv); args != "" {
+		runCoordinate(context.Background(), strings.Split(args, "\n"))
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// memBroker is an in-memory broker, every consumer of a topic gets all
+// messages produced to it after it subscribed.
+type memBroker struct {
+	mu   sync.Mutex
+	subs map[string]map[chan brokers.Message]bool
+}
+
+func newMemBroker() *memBroker {
+	return &memBroker{subs: make(map[string]map[chan brokers.Message]bool)}
+}
+
+// unreachable is a broker address memBroker can't connect to.
+const unreachable = "unreachable"
+
+// client returns Client of the broker, see newClient.
+func (b *memBroker) client(cfg Config, _ string) (Client, error) {
+	if cfg.Brokers == unreachable {
+		return nil, fmt.Errorf("dial %s: connection refused", cfg.Brokers)
+	}
+	return memClient{b}, nil
+}
+
+type memClient struct {
+	b *memBroker
+}
+
+func (c memClient) Produce(ctx context.Context, topic, key, value string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	for ch := range c.b.subs[topic] {
+		ch <- brokers.Message{Key: key, Value: value}
+	}
+	return nil
+}
+
+func (c memClient) Consume(ctx context.Context, topic string) (chan brokers.Message, error) {
+	ch := make(chan brokers.Message, 1<<16)
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	if c.b.subs[topic] == nil {
+		c.b.subs[topic] = make(map[chan brokers.Message]bool)
+	}
+	c.b.subs[topic][ch] = true
+	go func() {
+		<-ctx.Done()
+		c.b.mu.Lock()
+		defer c.b.mu.Unlock()
+		delete(c.b.subs[topic], ch)
+		close(ch)
+	}()
+	return ch, nil
+}
+
+func (c memClient) Close() error {
+	return nil
+}
+
+// recorder keeps a copy of the response stream.
+type recorder struct {
+	http.ResponseWriter
+	mu  *sync.Mutex
+	buf *bytes.Buffer
+}
+
+func (r recorder) Write(b []byte) (int, error) {
+	r.mu.Lock()
+	r.buf.Write(b)
+	r.mu.Unlock()
+	return r.ResponseWriter.Write(b)
+}
+
+func (r recorder) Flush() {
+	r.ResponseWriter.(http.Flusher).Flush()
+}
+
+// testAgent is an agent served on 127.0.0.1.
+type testAgent struct {
+	srv     *httptest.Server
+	brokers []string // Overrides scenario brokers.
+	mu      sync.Mutex
+	buf     bytes.Buffer // Run response stream.
+}
+
+// startAgent starts an agent.
+func startAgent(t *testing.T) *testAgent {
+	t.Helper()
+	ta := &testAgent{}
+	a := &agent{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/clock", a.clock)
+	mux.HandleFunc("/run", func(w http.ResponseWriter, r *http.Request) {
+		a.run(recorder{w, &ta.mu, &ta.buf}, r)
+	})
+	ta.srv = httptest.NewServer(mux)
+	t.Cleanup(ta.srv.Close)
+	return ta
+}
+
+// events returns events streamed by the agent since the last call.
+func (ta *testAgent) events(t *testing.T) []agentEvent {
+	t.Helper()
+	ta.mu.Lock()
+	defer ta.mu.Unlock()
+	defer ta.buf.Reset()
+	var events []agentEvent
+	sc := bufio.NewScanner(bytes.NewReader(ta.buf.Bytes()))
+	sc.Buffer(nil, 64<<20)
+	for sc.Scan() {
+		var e agentEvent
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("invalid event %q: %v", sc.Text(), err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+// coordinate writes cluster of agents and runs "coordinate" command on it
+// in a subprocess, it returns output and exit error.
+func coordinate(t *testing.T, agents []*testAgent) (string, string, error) {
+	t.Helper()
+	dir := t.TempDir()
+	scenario := `{
+  "name": "cluster",
+  "driver": "kafka",
+  "brokers": ["memory"],
+  "duration": "2s",
+  "drain": "2s",
+  "groups": [{"topics": ["t0"], "rate": 200, "size": "fixed:128", "producers": 1, "consumers": 1}],
+  "assertions": ["missing == 0", "throughput > 0"]
+}`
+	if err := os.WriteFile(filepath.Join(dir, "scenario.json"), []byte(scenario), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cluster := Cluster{Scenario: "scenario.json", StartDelay: duration(500 * time.Millisecond)}
+	for _, a := range agents {
+		cluster.Agents = append(cluster.Agents, clusterAgent{URL: a.srv.URL, Brokers: a.brokers})
+	}
+	b, err := json.Marshal(cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clusterFile := filepath.Join(dir, "cluster.json")
+	if err := os.WriteFile(clusterFile, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), coordinateEnv+"=-out\n"+dir+"\n"+clusterFile)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err = cmd.Run()
+	return dir, stdout.String() + stderr.String(), err
+}
+
+func TestCoordinate(t *testing.T) {
+	broker := newMemBroker()
+	newClient = broker.client
+	t.Cleanup(func() { newClient = NewClient })
+
+	agents := []*testAgent{startAgent(t), startAgent(t), startAgent(t)}
+	dir, out, err := coordinate(t, agents)
+	if err != nil {
+		t.Fatalf("coordinate failed: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "All 2 assertions passed") {
+		t.Errorf("assertions of merged result are not reported:\n%s", out)
+	}
+
+	names := make([]string, len(agents))
+	results := make([]Result, len(agents))
+	for i, a := range agents {
+		names[i] = fmt.Sprintf("agent%d", i)
+		if results[i], err = readResult(filepath.Join(dir, names[i]+".result.json")); err != nil {
+			t.Fatal(err)
+		}
+
+		// Accepted, progress at least once a second, the result.
+		events := a.events(t)
+		if len(events) < 3 {
+			t.Fatalf("%s: got %d events, want accepted, progress and result", names[i], len(events))
+		}
+		if first := events[0]; first.Progress != nil || first.Result != nil {
+			t.Errorf("%s: first event %+v, want empty accepted event", names[i], first)
+		}
+		for _, e := range events[1 : len(events)-1] {
+			if e.Progress == nil || e.Result != nil {
+				t.Errorf("%s: got %+v, want progress event", names[i], e)
+			}
+		}
+		last := events[len(events)-1]
+		if last.Result == nil {
+			t.Fatalf("%s: last event %+v, want result", names[i], last)
+		}
+		if last.Result.RunID != results[i].RunID {
+			t.Errorf("%s: streamed result of run %s, written %s", names[i], last.Result.RunID, results[i].RunID)
+		}
+	}
+
+	merged, err := mergeResults(names, results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var produced, consumed, samples int64
+	for i, res := range results {
+		if res.Produced == 0 || res.Consumed != res.Produced {
+			t.Errorf("%s: produced %d, consumed %d", names[i], res.Produced, res.Consumed)
+		}
+		produced += res.Produced
+		consumed += res.Consumed
+		samples += res.Percentiles.Latency.Count
+	}
+	if merged.Produced != produced || merged.Consumed != consumed {
+		t.Errorf("merged produced %d, consumed %d, want sums %d and %d", merged.Produced, merged.Consumed, produced, consumed)
+	}
+	if len(merged.Hosts) != len(agents) {
+		t.Errorf("merged %d hosts, want %d", len(merged.Hosts), len(agents))
+	}
+	if merged.Errors.Missing != 0 || merged.Errors.Duplicated != 0 {
+		t.Errorf("merged errors %+v, want none", merged.Errors)
+	}
+	if merged.Throughput <= 0 || merged.ApproxThroughput {
+		t.Errorf("merged throughput %v (approximate %v), want exact positive", merged.Throughput, merged.ApproxThroughput)
+	}
+	if merged.Percentiles.Latency.Count != samples {
+		t.Errorf("merged %d latency samples, want %d", merged.Percentiles.Latency.Count, samples)
+	}
+}
+
+func TestCoordinateAgentFailure(t *testing.T) {
+	broker := newMemBroker()
+	newClient = broker.client
+	t.Cleanup(func() { newClient = NewClient })
+
+	agents := []*testAgent{startAgent(t), startAgent(t), startAgent(t)}
+	failing := agents[1]
+	failing.brokers = []string{unreachable}
+	_, out, err := coordinate(t, agents)
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() == 0 {
+		t.Fatalf("coordinate returned %v, want non-zero exit\n%s", err, out)
+	}
+	if !strings.Contains(out, "Run failed on agent agent1: topic t0: dial unreachable") {
+		t.Errorf("failed agent is not reported:\n%s", out)
+	}
+	events := failing.events(t)
+	if len(events) < 2 || events[len(events)-1].Error == "" {
+		t.Errorf("failing agent streamed %+v, want accepted and error events", events)
+	}
+
+	// The agent survives a failed run and takes the next one.
+	failing.brokers = nil
+	if _, out, err := coordinate(t, []*testAgent{failing}); err != nil {
+		t.Fatalf("agent failed the run after a failed one: %v\n%s", err, out)
+	}
+	if events := failing.events(t); len(events) == 0 || events[len(events)-1].Result == nil {
+		t.Errorf("agent streamed %+v after a failed run, want the result", events)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Envelope is the header every benchmark message starts with.
+// It identifies the run and producer stream the message belongs to,
+// so consumers can measure latency and detect lost, duplicated
+// and reordered deliveries.
+//
+// Run id is random per process, so streams of producers running on other
+// hosts don't collide. A producer that runs without local consumers ends its
+// stream with an end marker telling consumers what to expect.
+//
+// Wire format (big endian):
+//
+//	magic(1) version(1) kind(1) run_id(8) producer_id(4) seq(8) intended_at(8) sent_at(8)
+//
+// End marker seq is the number of produce calls made, intended_at and
+// sent_at are producer start and stop times, it is followed by sequence
+// numbers of failed produce calls (8 bytes each).
+type Envelope struct {
+	End        bool // End of stream marker.
+	RunID      uint64
+	ProducerID uint32
+	Seq        uint64
+	IntendedAt int64    // UnixNano, when the schedule wanted the message sent.
+	SentAt     int64    // UnixNano
+	Failed     []uint64 // End marker only.
+}
+
+const (
+	envelopeMagic   = 0xB5
+	envelopeVersion = 3
+	envelopeSize    = 39
+)
+
+// Envelope kinds.
+const (
+	envelopeData = 0
+	envelopeEnd  = 1
+)
+
+var errNotEnvelope = errors.New("not a benchmark message")
+
+// AppendTo appends encoded envelope to b.
+func (e Envelope) AppendTo(b []byte) []byte {
+	kind := byte(envelopeData)
+	if e.End {
+		kind = envelopeEnd
+	}
+	b = append(b, envelopeMagic, envelopeVersion, kind)
+	b = binary.BigEndian.AppendUint64(b, e.RunID)
+	b = binary.BigEndian.AppendUint32(b, e.ProducerID)
+	b = binary.BigEndian.AppendUint64(b, e.Seq)
+	b = binary.BigEndian.AppendUint64(b, uint64(e.IntendedAt))
+	b = binary.BigEndian.AppendUint64(b, uint64(e.SentAt))
+	if e.End {
+		for _, seq := range e.Failed {
+			b = binary.BigEndian.AppendUint64(b, seq)
+		}
+	}
+	return b
+}
+
+// ParseEnvelope decodes envelope from the beginning of message value.
+func ParseEnvelope(value string) (Envelope, error) {
+	if len(value) < 2 || value[0] != envelopeMagic {
+		return Envelope{}, errNotEnvelope
+	}
+	if value[1] != envelopeVersion {
+		return Envelope{}, fmt.Errorf("unsupported envelope version %d", value[1])
+	}
+	if len(value) < envelopeSize {
+		return Envelope{}, fmt.Errorf("truncated envelope (%d bytes)", len(value))
+	}
+
+	e := Envelope{
+		RunID:      beUint64(value[3:]),
+		ProducerID: beUint32(value[11:]),
+		Seq:        beUint64(value[15:]),
+		IntendedAt: int64(beUint64(value[23:])),
+		SentAt:     int64(beUint64(value[31:])),
+	}
+	switch value[2] {
+	case envelopeData:
+	case envelopeEnd:
+		e.End = true
+		failed := value[envelopeSize:]
+		if len(failed)%8 != 0 {
+			return Envelope{}, fmt.Errorf("truncated end marker (%d bytes)", len(value))
+		}
+		for ; len(failed) > 0; failed = failed[8:] {
+			e.Failed = append(e.Failed, beUint64(failed))
+		}
+	default:
+		return Envelope{}, fmt.Errorf("unknown envelope kind %d", value[2])
+	}
+
+	return e, nil
+}
+
+// beUint32 decodes big endian uint32 from string without copying it.
+func beUint32(s string) uint32 {
+	_ = s[3]
+	return uint32(s[3]) | uint32(s[2])<<8 | uint32(s[1])<<16 | uint32(s[0])<<24
+}
+
+// beUint64 decodes big endian uint64 from string without copying it.
+func beUint64(s string) uint64 {
+	_ = s[7]
+	return uint64(s[7]) | uint64(s[6])<<8 | uint64(s[5])<<16 | uint64(s[4])<<24 |
+		uint64(s[3])<<32 | uint64(s[2])<<40 | uint64(s[1])<<48 | uint64(s[0])<<56
+}
+
+// newRunID returns random identifier for a benchmark run.
+func newRunID() uint64 {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("failed to generate run id: %v", err))
+	}
+	return binary.BigEndian.Uint64(b[:])
+}
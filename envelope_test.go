@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	for _, e := range []Envelope{
+		{},
+		{RunID: 0x0123456789abcdef, ProducerID: 7, Seq: 42, IntendedAt: 1700000000000000000, SentAt: 1700000000000001234},
+		{RunID: ^uint64(0), ProducerID: ^uint32(0), Seq: ^uint64(0), IntendedAt: -1, SentAt: 1},
+		{End: true, RunID: 1, ProducerID: 2, Seq: 100, IntendedAt: 10, SentAt: 20},
+		{End: true, RunID: 1, ProducerID: 2, Seq: 100, IntendedAt: 10, SentAt: 20, Failed: []uint64{3, 50, 99}},
+	} {
+		b := e.AppendTo([]byte("prefix"))[len("prefix"):]
+		if !e.End && len(b) != envelopeSize {
+			t.Errorf("%+v: encoded to %d bytes, want %d", e, len(b), envelopeSize)
+		}
+		// Data messages carry payload after the envelope.
+		value := string(b)
+		if !e.End {
+			value += "payload"
+		}
+		got, err := ParseEnvelope(value)
+		if err != nil {
+			t.Errorf("%+v: %v", e, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, e) {
+			t.Errorf("got %+v, want %+v", got, e)
+		}
+	}
+}
+
+func TestParseEnvelopeErrors(t *testing.T) {
+	data := string(Envelope{Seq: 1}.AppendTo(nil))
+	end := string(Envelope{End: true, Failed: []uint64{1}}.AppendTo(nil))
+	for _, tt := range []struct {
+		name  string
+		value string
+		err   string
+	}{
+		{"empty", "", errNotEnvelope.Error()},
+		{"foreign", "hello world", errNotEnvelope.Error()},
+		{"old version", data[:1] + "\x02" + data[2:], "unsupported envelope version 2"},
+		{"truncated", data[:envelopeSize-1], "truncated envelope"},
+		{"unknown kind", data[:2] + "\x09" + data[3:], "unknown envelope kind 9"},
+		{"truncated end marker", end[:len(end)-3], "truncated end marker"},
+	} {
+		_, err := ParseEnvelope(tt.value)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
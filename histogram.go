@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// Histogram is a fixed memory log-linear (HDR style) histogram of latencies.
+//
+// Values are recorded in microseconds. Range is split into power of two buckets,
+// each of them split linearly into sub-buckets, so relative error of any recorded
+// value stays within configured number of significant decimal digits.
+// Values above the trackable maximum are clamped to it (exact max is kept separately).
+type Histogram struct {
+	precision int   // significant decimal digits
+	highest   int64 // highest trackable value
+
+	subBucketHalfCountMagnitude int
+	subBucketHalfCount          int
+	subBucketMask               int64
+	subBucketCount              int
+
+	counts []int64
+	total  int64
+	min    int64
+	max    int64
+	sum    float64
+}
+
+const (
+	// histHighest is the highest trackable latency (in microseconds).
+	histHighest = int64(time.Hour / time.Microsecond)
+	// defaultPrecision is the default number of significant decimal digits.
+	defaultPrecision = 3
+	// maxPrecision is the highest precision of a run. Memory of a histogram
+	// grows tenfold with every digit: about 188KB at 3, 2.5MB at 4 and 16MB
+	// at 5, and a run keeps several per partition, producer and size bucket.
+	maxPrecision = 3
+)
+
+// NewHistogram creates a histogram with given number of significant digits (1-5),
+// higher ones than maxPrecision are only read from results.
+func NewHistogram(precision int) *Histogram {
+	if precision < 1 || precision > 5 {
+		panic(fmt.Sprintf("histogram precision must be in 1..5 range, got %d", precision))
+	}
+
+	largestSingleUnit := 2 * int64(math.Pow10(precision))
+	subBucketCountMagnitude := int(math.Ceil(math.Log2(float64(largestSingleUnit))))
+	h := &Histogram{
+		precision:                   precision,
+		highest:                     histHighest,
+		subBucketHalfCountMagnitude: subBucketCountMagnitude - 1,
+		subBucketCount:              1 << subBucketCountMagnitude,
+		subBucketHalfCount:          1 << (subBucketCountMagnitude - 1),
+		subBucketMask:               int64(1)<<subBucketCountMagnitude - 1,
+		min:                         math.MaxInt64,
+	}
+
+	buckets := 1
+	for smallestUntrackable := int64(h.subBucketCount); smallestUntrackable <= h.highest; smallestUntrackable <<= 1 {
+		buckets++
+	}
+	h.counts = make([]int64, (buckets+1)*h.subBucketHalfCount)
+
+	return h
+}
+
+// Record adds latency to the histogram.
+func (h *Histogram) Record(d time.Duration) {
+	h.RecordValue(int64(d/time.Microsecond), 1)
+}
+
+// RecordValue adds n occurrences of value (in microseconds) to the histogram.
+func (h *Histogram) RecordValue(v, n int64) {
+	if v < 0 {
+		v = 0
+	}
+	if v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+	h.sum += float64(v) * float64(n)
+	h.total += n
+	if v > h.highest {
+		v = h.highest
+	}
+	h.counts[h.countsIndex(v)] += n
+}
+
+func (h *Histogram) bucketIndex(v int64) int {
+	pow2Ceiling := 64 - bits.LeadingZeros64(uint64(v|h.subBucketMask))
+	return pow2Ceiling - (h.subBucketHalfCountMagnitude + 1)
+}
+
+func (h *Histogram) countsIndex(v int64) int {
+	bi := h.bucketIndex(v)
+	sbi := int(v >> bi)
+	return (bi+1)<<h.subBucketHalfCountMagnitude + sbi - h.subBucketHalfCount
+}
+
+// valueAt returns the highest value equivalent to the one stored at counts index i.
+func (h *Histogram) valueAt(i int) int64 {
+	bi := (i >> h.subBucketHalfCountMagnitude) - 1
+	sbi := (i & (h.subBucketHalfCount - 1)) + h.subBucketHalfCount
+	if bi < 0 {
+		sbi -= h.subBucketHalfCount
+		bi = 0
+	}
+	lowest := int64(sbi) << bi
+	return lowest + int64(1)<<bi - 1
+}
+
+// Reset clears all recorded values.
+func (h *Histogram) Reset() {
+	for i := range h.counts {
+		h.counts[i] = 0
+	}
+	h.total, h.sum = 0, 0
+	h.min, h.max = math.MaxInt64, 0
+}
+
+// Count returns number of recorded values.
+func (h *Histogram) Count() int64 {
+	return h.total
+}
+
+// Min returns the smallest recorded value.
+func (h *Histogram) Min() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.min) * time.Microsecond
+}
+
+// Max returns the largest recorded value.
+func (h *Histogram) Max() time.Duration {
+	return time.Duration(h.max) * time.Microsecond
+}
+
+// Mean returns the mean of recorded values.
+func (h *Histogram) Mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.sum/float64(h.total)) * time.Microsecond
+}
+
+// StdDev returns standard deviation of recorded values in milliseconds.
+func (h *Histogram) StdDev() float64 {
+	if h.total < 2 {
+		return 0
+	}
+
+	mean := h.sum / float64(h.total)
+	var sq float64
+	for i, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+		d := float64(h.valueAt(i)) - mean
+		sq += d * d * float64(c)
+	}
+
+	return math.Sqrt(sq/float64(h.total-1)) / 1000
+}
+
+// Quantile returns value at quantile q (0..1) of recorded values by nearest
+// rank: the smallest value that at least q of all values are at or below,
+// see nearestRank. The value is the highest one equivalent to its bucket
+// (so within precision), but never above the exact max.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+
+	rank := nearestRank(q, h.total)
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			return time.Duration(h.reported(i)) * time.Microsecond
+		}
+	}
+
+	return h.Max()
+}
+
+// nearestRank returns 1-based rank of quantile q of n sorted values,
+// ceil(q*n) clamped to 1..n. Floating point error of q*n is ignored,
+// so that P90 of 10 values is the 9th one, not the 10th.
+func nearestRank(q float64, n int64) int64 {
+	x := q * float64(n)
+	rank := int64(math.Ceil(x - x*1e-12))
+	if rank < 1 {
+		return 1
+	}
+	if rank > n {
+		return n
+	}
+	return rank
+}
+
+// reported returns value reported for values of counts index i.
+func (h *Histogram) reported(i int) int64 {
+	if v := h.valueAt(i); v < h.max {
+		return v
+	}
+	return h.max
+}
+
+// cumulative returns number of values at or below each non-empty bucket
+// and the value reported for the bucket, for repeated quantile lookups.
+func (h *Histogram) cumulative() (counts, values []int64) {
+	var seen int64
+	for i, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+		seen += c
+		counts = append(counts, seen)
+		values = append(values, h.reported(i))
+	}
+	return counts, values
+}
+
+// Merge adds all values recorded by other histogram to h.
+func (h *Histogram) Merge(other *Histogram) error {
+	if h.precision != other.precision || h.highest != other.highest {
+		return fmt.Errorf("can't merge histograms with different precision (%d and %d)", h.precision, other.precision)
+	}
+	if other.total == 0 {
+		return nil
+	}
+
+	for i, c := range other.counts {
+		h.counts[i] += c
+	}
+	h.total += other.total
+	h.sum += other.sum
+	if other.min < h.min {
+		h.min = other.min
+	}
+	if other.max > h.max {
+		h.max = other.max
+	}
+
+	return nil
+}
+
+// histogramJSON is serialized histogram form.
+// Only non-empty counts are stored as (index, count) pairs.
+type histogramJSON struct {
+	Precision int        `json:"precision"`
+	Highest   int64      `json:"highest_us"`
+	Total     int64      `json:"total"`
+	Min       int64      `json:"min_us"`
+	Max       int64      `json:"max_us"`
+	Sum       float64    `json:"sum_us"`
+	Counts    [][2]int64 `json:"counts"`
+}
+
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	hj := histogramJSON{
+		Precision: h.precision,
+		Highest:   h.highest,
+		Total:     h.total,
+		Min:       h.min,
+		Max:       h.max,
+		Sum:       h.sum,
+		Counts:    [][2]int64{},
+	}
+	if h.total == 0 {
+		hj.Min = 0
+	}
+	for i, c := range h.counts {
+		if c != 0 {
+			hj.Counts = append(hj.Counts, [2]int64{int64(i), c})
+		}
+	}
+
+	return json.Marshal(hj)
+}
+
+func (h *Histogram) UnmarshalJSON(b []byte) error {
+	var hj histogramJSON
+	if err := json.Unmarshal(b, &hj); err != nil {
+		return err
+	}
+	if hj.Precision < 1 || hj.Precision > 5 {
+		return fmt.Errorf("invalid histogram precision %d", hj.Precision)
+	}
+	if hj.Highest != histHighest {
+		return fmt.Errorf("unsupported histogram range (highest value %d)", hj.Highest)
+	}
+
+	*h = *NewHistogram(hj.Precision)
+	var total int64
+	for _, c := range hj.Counts {
+		if c[0] < 0 || c[0] >= int64(len(h.counts)) || c[1] < 0 {
+			return errors.New("histogram counts are out of range")
+		}
+		h.counts[c[0]] += c[1]
+		total += c[1]
+	}
+	if total != hj.Total {
+		return fmt.Errorf("histogram total %d doesn't match sum of counts %d", hj.Total, total)
+	}
+	h.total = hj.Total
+	h.sum = hj.Sum
+	h.max = hj.Max
+	if h.total > 0 {
+		h.min = hj.Min
+	}
+
+	return nil
+}
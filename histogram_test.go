@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// latencySample returns n log-normal latencies in microseconds, 1ms median.
+func latencySample(seed int64, n int) []int64 {
+	rnd := rand.New(rand.NewSource(seed))
+	values := make([]int64, n)
+	for i := range values {
+		values[i] = int64(math.Exp(rnd.NormFloat64()*1.5) * 1000)
+	}
+	return values
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	quantiles := []float64{0, 0.001, 0.1, 0.5, 0.9, 0.99, 0.999, 1}
+	for precision := 1; precision <= 5; precision++ {
+		for _, n := range []int{1, 10, 1000, 100000} {
+			values := latencySample(int64(n), n)
+			h := NewHistogram(precision)
+			for _, v := range values {
+				h.RecordValue(v, 1)
+			}
+			sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+			for _, q := range quantiles {
+				exact := values[nearestRank(q, int64(n))-1]
+				got := int64(h.Quantile(q) / time.Microsecond)
+				// The highest value of the bucket, within precision above the exact one.
+				if got < exact || float64(got-exact) > float64(exact)/math.Pow10(precision) {
+					t.Errorf("precision %d, %d values: quantile %v is %dus, want %dus within precision", precision, n, q, got, exact)
+				}
+			}
+			if got, want := h.Quantile(1), time.Duration(values[n-1])*time.Microsecond; got != want {
+				t.Errorf("precision %d, %d values: max quantile is %v, want exact max %v", precision, n, got, want)
+			}
+		}
+	}
+}
+
+func TestNearestRank(t *testing.T) {
+	for _, tt := range []struct {
+		q    float64
+		n    int64
+		want int64
+	}{
+		{0, 10, 1},
+		{0.1, 10, 1},
+		{0.5, 10, 5},
+		{0.9, 10, 9}, // Not 10 because of 0.9*10 rounding error.
+		{0.91, 10, 10},
+		{1, 10, 10},
+		{0.999, 1000, 999},
+		{0.5, 1, 1},
+		{1.5, 10, 10},
+	} {
+		if got := nearestRank(tt.q, tt.n); got != tt.want {
+			t.Errorf("nearestRank(%v, %d) = %d, want %d", tt.q, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestHistogramClamp(t *testing.T) {
+	for precision := 1; precision <= 5; precision++ {
+		h := NewHistogram(precision)
+		h.Record(30 * time.Minute)
+		h.Record(2 * time.Hour)
+		h.Record(3 * time.Hour)
+
+		if got := h.Max(); got != 3*time.Hour {
+			t.Errorf("precision %d: max is %v, want exact 3h", precision, got)
+		}
+		if got := h.Count(); got != 3 {
+			t.Errorf("precision %d: count is %d, want 3", precision, got)
+		}
+		// Values above 1h share the bucket of the highest trackable value.
+		limit := time.Duration(float64(time.Hour) * (1 + math.Pow10(-precision)))
+		for _, q := range []float64{0.5, 1} {
+			if got := h.Quantile(q); got < time.Hour || got > limit {
+				t.Errorf("precision %d: quantile %v is %v, want clamped to 1h within precision", precision, q, got)
+			}
+		}
+		if got := h.Quantile(0.1); got < 30*time.Minute || got >= time.Hour {
+			t.Errorf("precision %d: quantile 0.1 is %v, want 30m within precision", precision, got)
+		}
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	a, b, all := NewHistogram(3), NewHistogram(3), NewHistogram(3)
+	for _, v := range latencySample(1, 5000) {
+		a.RecordValue(v, 1)
+		all.RecordValue(v, 1)
+	}
+	for _, v := range latencySample(2, 3000) {
+		b.RecordValue(v*10, 1)
+		all.RecordValue(v*10, 1)
+	}
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Merge(NewHistogram(3)); err != nil {
+		t.Fatal(err)
+	}
+	// Sums of different order may differ in the last bits.
+	if math.Abs(a.sum-all.sum) > 1e-9*all.sum {
+		t.Errorf("merged sum is %v, want %v", a.sum, all.sum)
+	}
+	a.sum = all.sum
+	if !reflect.DeepEqual(a, all) {
+		t.Errorf("merged histogram differs from one with all values recorded")
+	}
+
+	if err := a.Merge(NewHistogram(2)); err == nil {
+		t.Errorf("merged histograms of different precision")
+	}
+}
+
+func TestHistogramJSON(t *testing.T) {
+	full := NewHistogram(4)
+	for _, v := range latencySample(3, 1000) {
+		full.RecordValue(v, 1)
+	}
+	full.Record(2 * time.Hour)
+	for name, h := range map[string]*Histogram{"empty": NewHistogram(2), "full": full} {
+		b, err := json.Marshal(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := &Histogram{}
+		if err := json.Unmarshal(b, got); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, h) {
+			t.Errorf("%s: histogram changed by JSON round trip", name)
+		}
+	}
+
+	for _, tt := range []struct {
+		json string
+		err  string
+	}{
+		{`{"precision":0,"highest_us":3600000000,"counts":[]}`, "precision"},
+		{`{"precision":3,"highest_us":1000,"counts":[]}`, "range"},
+		{`{"precision":3,"highest_us":3600000000,"total":1,"counts":[[-1,1]]}`, "out of range"},
+		{`{"precision":3,"highest_us":3600000000,"total":1,"counts":[[100000000,1]]}`, "out of range"},
+		{`{"precision":3,"highest_us":3600000000,"total":2,"counts":[[1,1]]}`, "doesn't match"},
+	} {
+		err := json.Unmarshal([]byte(tt.json), &Histogram{})
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.json, err, tt.err)
+		}
+	}
+}
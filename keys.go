@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// keyDist picks message keys (as key indices in [0, cardinality) range).
+type keyDist interface {
+	next(rnd *rand.Rand, seq uint64) uint64
+	String() string
+}
+
+// maxKeyCardinality bounds zipfian key space, its normalization constant
+// is computed over all keys at startup.
+const maxKeyCardinality = 100_000_000
+
+// parseKeyDist parses message key distribution spec:
+//
+//	none (messages have no key)
+//	sequential:N (producer cycles through keys in order)
+//	uniform:N
+//	zipfian:N,SKEW (0 < SKEW < 1, key 0 is the hottest)
+//
+// It returns nil distribution for unkeyed messages.
+func parseKeyDist(spec string) (keyDist, error) {
+	kind, args, _ := strings.Cut(spec, ":")
+	if kind == "none" || kind == "" {
+		if args != "" {
+			return nil, fmt.Errorf("none key distribution takes no parameters, got %q", args)
+		}
+		return nil, nil
+	}
+
+	var nums []float64
+	if args != "" {
+		for _, a := range strings.Split(args, ",") {
+			n, err := strconv.ParseFloat(strings.TrimSpace(a), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s key distribution parameter %q", kind, a)
+			}
+			nums = append(nums, n)
+		}
+	}
+	if len(nums) > 0 && (nums[0] < 1 || nums[0] > maxKeyCardinality || nums[0] != math.Trunc(nums[0])) {
+		return nil, fmt.Errorf("key cardinality must be an integer in [1, %d] range, got %q", maxKeyCardinality, args)
+	}
+
+	switch kind {
+	case "sequential":
+		if len(nums) != 1 {
+			return nil, fmt.Errorf("sequential key distribution wants key cardinality, got %q", args)
+		}
+		return sequentialKeys(nums[0]), nil
+	case "uniform":
+		if len(nums) != 1 {
+			return nil, fmt.Errorf("uniform key distribution wants key cardinality, got %q", args)
+		}
+		return uniformKeys(nums[0]), nil
+	case "zipfian":
+		if len(nums) != 2 || nums[1] <= 0 || nums[1] >= 1 {
+			return nil, fmt.Errorf("zipfian key distribution wants N,SKEW with 0 < SKEW < 1, got %q", args)
+		}
+		return newZipfianKeys(uint64(nums[0]), nums[1]), nil
+	}
+
+	return nil, fmt.Errorf("unknown key distribution %q (want none, sequential, uniform or zipfian)", kind)
+}
+
+// formatKey returns message key of given index.
+func formatKey(k uint64) string {
+	return "key-" + strconv.FormatUint(k, 10)
+}
+
+type sequentialKeys uint64
+
+func (d sequentialKeys) next(_ *rand.Rand, seq uint64) uint64 { return seq % uint64(d) }
+func (d sequentialKeys) String() string                       { return fmt.Sprintf("sequential:%d", uint64(d)) }
+
+type uniformKeys uint64
+
+func (d uniformKeys) next(rnd *rand.Rand, _ uint64) uint64 { return uint64(rnd.Int63n(int64(d))) }
+func (d uniformKeys) String() string                       { return fmt.Sprintf("uniform:%d", uint64(d)) }
+
+// zipfianKeys samples keys with probability proportional to 1/(rank+1)^skew
+// using Gray et al. "Quickly Generating Billion-Record Synthetic Databases"
+// method (the one YCSB uses).
+type zipfianKeys struct {
+	n                 uint64
+	skew              float64
+	alpha, zetan, eta float64
+	half              float64 // 1 + 0.5^skew
+}
+
+func newZipfianKeys(n uint64, skew float64) *zipfianKeys {
+	d := &zipfianKeys{n: n, skew: skew, alpha: 1 / (1 - skew), zetan: zeta(n, skew), half: 1 + math.Pow(0.5, skew)}
+	d.eta = (1 - math.Pow(2/float64(n), 1-skew)) / (1 - zeta(2, skew)/d.zetan)
+	return d
+}
+
+type zetaKey struct {
+	n    uint64
+	skew float64
+}
+
+// zetas caches zeta, the same spec is parsed by scenario validation,
+// by the run and by every run of a sweep or search.
+var zetas = struct {
+	sync.Mutex
+	m map[zetaKey]float64
+}{m: make(map[zetaKey]float64)}
+
+// zeta returns sum of 1/i^skew for i in [1, n], it takes O(n) time once per n and skew.
+func zeta(n uint64, skew float64) float64 {
+	zetas.Lock()
+	defer zetas.Unlock()
+	k := zetaKey{n: n, skew: skew}
+	if z, ok := zetas.m[k]; ok {
+		return z
+	}
+	sum := 0.0
+	for i := uint64(1); i <= n; i++ {
+		sum += 1 / math.Pow(float64(i), skew)
+	}
+	zetas.m[k] = sum
+	return sum
+}
+
+func (d *zipfianKeys) next(rnd *rand.Rand, _ uint64) uint64 {
+	u := rnd.Float64()
+	uz := u * d.zetan
+	if uz < 1 || d.n == 1 {
+		return 0
+	}
+	if uz < d.half {
+		return 1
+	}
+	k := uint64(float64(d.n) * math.Pow(d.eta*u-d.eta+1, d.alpha))
+	if k >= d.n {
+		return d.n - 1
+	}
+	return k
+}
+
+func (d *zipfianKeys) String() string { return fmt.Sprintf("zipfian:%d,%g", d.n, d.skew) }
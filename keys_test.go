@@ -0,0 +1,135 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestParseKeyDist(t *testing.T) {
+	for _, tt := range []struct {
+		spec string
+		want string // Canonical spec, empty if invalid or unkeyed.
+		err  bool
+	}{
+		{"none", "", false},
+		{"", "", false},
+		{"sequential:10", "sequential:10", false},
+		{"uniform:1000", "uniform:1000", false},
+		{"zipfian:1000,0.99", "zipfian:1000,0.99", false},
+		{"none:10", "", true},
+		{"sequential", "", true},
+		{"uniform:0", "", true},
+		{"uniform:1.5", "", true},
+		{"uniform:1000000000", "", true},
+		{"zipfian:1000", "", true},
+		{"zipfian:1000,1", "", true},
+		{"zipfian:1000,0", "", true},
+		{"hot:10", "", true},
+	} {
+		d, err := parseKeyDist(tt.spec)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q: accepted, want error", tt.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.spec, err)
+			continue
+		}
+		got := ""
+		if d != nil {
+			got = d.String()
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestKeyDistSamples(t *testing.T) {
+	seq := sequentialKeys(3)
+	for i, want := range []uint64{0, 1, 2, 0, 1} {
+		if got := seq.next(nil, uint64(i)); got != want {
+			t.Errorf("sequential key of message %d is %d, want %d", i, got, want)
+		}
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	counts := make([]int, 10)
+	for i := 0; i < 100000; i++ {
+		counts[uniformKeys(10).next(rnd, uint64(i))]++
+	}
+	for k, c := range counts {
+		if c < 9500 || c > 10500 {
+			t.Errorf("uniform key %d picked %d times of 100000, want about 10000", k, c)
+		}
+	}
+}
+
+func TestZipfianKeys(t *testing.T) {
+	const n, skew, samples = 1000, 0.99, 1000000
+	d := newZipfianKeys(n, skew)
+	rnd := rand.New(rand.NewSource(1))
+	counts := make([]float64, n)
+	for i := 0; i < samples; i++ {
+		k := d.next(rnd, uint64(i))
+		if k >= n {
+			t.Fatalf("key %d out of [0, %d) range", k, n)
+		}
+		counts[k]++
+	}
+
+	// Key k is picked with probability 1/(k+1)^skew/zeta(n): exactly for
+	// the two hottest keys, approximately for the rest.
+	z := zeta(n, skew)
+	var got, want float64
+	for k := 0; k < n; k++ {
+		p := 1 / math.Pow(float64(k+1), skew) / z
+		got, want = got+counts[k]/samples, want+p
+		if k < 2 && math.Abs(counts[k]/samples-p)/p > 0.02 {
+			t.Errorf("key %d picked %.0f times, want about %.0f", k, counts[k], p*samples)
+		}
+		if (k == 9 || k == 99 || k == 499) && math.Abs(got-want)/want > 0.05 {
+			t.Errorf("top %d keys picked in %.3f of messages, want about %.3f", k+1, got, want)
+		}
+	}
+	if counts[0] < 10*counts[n/2] {
+		t.Errorf("hottest key picked %.0f times, middle one %.0f: want skewed", counts[0], counts[n/2])
+	}
+
+	if one := newZipfianKeys(1, skew); one.next(rnd, 0) != 0 {
+		t.Errorf("single key distribution picked another key")
+	}
+}
+
+func TestZeta(t *testing.T) {
+	if got, want := zeta(3, 0.5), 1+1/math.Sqrt(2)+1/math.Sqrt(3); math.Abs(got-want) > 1e-12 {
+		t.Errorf("zeta(3, 0.5) = %v, want %v", got, want)
+	}
+	// Cached value is reused.
+	zetas.Lock()
+	zetas.m[zetaKey{n: 3, skew: 0.5}] = 42
+	zetas.Unlock()
+	defer func() {
+		zetas.Lock()
+		delete(zetas.m, zetaKey{n: 3, skew: 0.5})
+		zetas.Unlock()
+	}()
+	if got := zeta(3, 0.5); got != 42 {
+		t.Errorf("zeta(3, 0.5) = %v, want cached 42", got)
+	}
+}
+
+func TestWorkloadSeed(t *testing.T) {
+	seed := workloadSeed(1, "t0", 0)
+	if workloadSeed(1, "t0", 0) != seed {
+		t.Errorf("seed of the same producer changed")
+	}
+	for _, other := range []int64{workloadSeed(2, "t0", 0), workloadSeed(1, "t1", 0), workloadSeed(1, "t0", 1)} {
+		if other == seed {
+			t.Errorf("seed %d is shared by producers of other topic, index or payload seed", seed)
+		}
+	}
+}
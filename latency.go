@@ -0,0 +1,44 @@
+package main
+
+// producerLatencies are latency histograms of a single producer stream
+// (or merged histograms of several of them).
+type producerLatencies struct {
+	// Latency is end-to-end latency measured from the actual send time.
+	Latency *Histogram `json:"latency"`
+	// Corrected is end-to-end latency measured from the scheduled send time,
+	// it differs from Latency only for open loop schedules.
+	Corrected *Histogram `json:"corrected"`
+	// Ack is the time Producer.Produce call took to get broker acknowledgement.
+	Ack *Histogram `json:"ack"`
+	// Append is time from send to broker timestamp and Delivery is time from
+	// broker timestamp to consumer receipt. Only recorded when the broker sets
+	// the timestamp itself (LogAppendTime), Kafka timestamps have millisecond precision.
+	Append   *Histogram `json:"append"`
+	Delivery *Histogram `json:"delivery"`
+}
+
+func newProducerLatencies(precision int) *producerLatencies {
+	return &producerLatencies{
+		Latency:   NewHistogram(precision),
+		Corrected: NewHistogram(precision),
+		Ack:       NewHistogram(precision),
+		Append:    NewHistogram(precision),
+		Delivery:  NewHistogram(precision),
+	}
+}
+
+func (l *producerLatencies) merge(other *producerLatencies) error {
+	if err := l.Latency.Merge(other.Latency); err != nil {
+		return err
+	}
+	if err := l.Corrected.Merge(other.Corrected); err != nil {
+		return err
+	}
+	if err := l.Ack.Merge(other.Ack); err != nil {
+		return err
+	}
+	if err := l.Append.Merge(other.Append); err != nil {
+		return err
+	}
+	return l.Delivery.Merge(other.Delivery)
+}
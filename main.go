@@ -3,9 +3,15 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
+	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
+
+	"streambench/brokers"
 )
 
 func main() {
@@ -13,33 +19,207 @@ func main() {
 		url         string
 		topics      string
 		msgSize     int
+		sizeDist    string
+		keys        string
 		numMessages int
 		minutes     int
 		broker      string
 		rate        int
 		producers   int
+		schedule    string
+		drain       time.Duration
+		warmup      time.Duration
+		cooldown    time.Duration
+		steady      SteadyState
+		interval    time.Duration
+		precision   int
+		resultFile  string
+		seriesFile  string
+		role        string
+		opts        brokers.Options
+		payload     PayloadConfig
+
+		scenarioFile string
+		baselineFile string
+		tolerance    float64
 	)
 
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "sweep":
+			runSweep(ctx, os.Args[2:])
+			return
+		case "search":
+			runSearch(ctx, os.Args[2:])
+			return
+		case "agent":
+			runAgent(ctx, os.Args[2:])
+			return
+		case "coordinate":
+			runCoordinate(ctx, os.Args[2:])
+			return
+		case "merge":
+			runMerge(os.Args[2:])
+			return
+		case "compare":
+			runCompare(os.Args[2:])
+			return
+		case "report":
+			runReport(os.Args[2:])
+			return
+		}
+	}
+
 	flag.StringVar(&url, "brokers", "", "url or list of broker urls comma separated")
 	flag.StringVar(&topics, "topics", "topic", "comma separated list of topic names")
 	flag.IntVar(&msgSize, "msg_size", 128, "message size")
+	flag.StringVar(&sizeDist, "msg_size_dist", "", "message size distribution: fixed:SIZE, uniform:MIN,MAX, lognormal:MEDIAN,SIGMA[,MAX] or empirical:FILE (overrides -msg_size)")
+	flag.StringVar(&keys, "keys", "none", "message key distribution: none, sequential:N, uniform:N or zipfian:N,SKEW (0 < SKEW < 1)")
+	flag.StringVar(&payload.Kind, "payload", payloadFill, "payload generator: fill, random, text, json or corpus")
+	flag.Int64Var(&payload.Seed, "payload_seed", 1, "payload generator seed")
+	flag.Float64Var(&payload.Ratio, "payload_ratio", 3, "target compression ratio of text payload")
+	flag.StringVar(&payload.Template, "payload_template", "", "JSON template file for json payload (built-in template if empty)")
+	flag.StringVar(&payload.Corpus, "payload_corpus", "", "file to sample corpus payload from")
 	flag.IntVar(&numMessages, "num_messages", 0, "number of messages to send per producer (by default there's one producer per topic)")
 	flag.IntVar(&minutes, "minutes", 0, "number of minutes to run the benchmark")
 	flag.StringVar(&broker, "driver", "redpanda", "driver to use (kafka, redpanda, nats, pulsar)")
 	flag.IntVar(&rate, "producer_rate", 1000, "number of messages per second to produce per producer (by default there's one producer per topic)")
 	flag.IntVar(&producers, "producers_per_topic", 1, "number producers per topic")
+	flag.StringVar(&schedule, "schedule", scheduleClosed, "producer schedule: closed (wait for previous message), constant or poisson (open loop)")
+	flag.DurationVar(&drain, "drain_timeout", 30*time.Second, "max time to wait for in-flight messages after producers stop")
+	flag.DurationVar(&warmup, "warmup", 0, "time excluded from latency measurement at the start (first and last 10% of the run if none of -warmup, -cooldown and -steady_window is set)")
+	flag.DurationVar(&cooldown, "cooldown", 0, "time excluded from latency measurement at the end of production (needs -minutes)")
+	flag.DurationVar((*time.Duration)(&steady.Window), "steady_window", 10*time.Second, "measure only after throughput and P50 latency are stable over this window (steady state detection is off unless set)")
+	flag.Float64Var(&steady.Tolerance, "steady_tolerance", 0.1, "max coefficient of variation of throughput and P50 latency in steady state")
+	flag.DurationVar(&interval, "interval", time.Second, "throughput and latency time series interval")
+	flag.IntVar(&precision, "hist_precision", defaultPrecision, "latency histogram precision (significant decimal digits, 1-3), each histogram takes about 188KB at 3")
+	flag.StringVar(&resultFile, "result", "result.json", "file to write JSON result document to (empty to skip)")
+	flag.StringVar(&seriesFile, "series", "series.csv", "file to write time series CSV to (empty to skip)")
+	flag.StringVar(&opts.Acks, "acks", "", "producer acks: none, leader or all (driver default if empty)")
+	flag.StringVar(&opts.Compression, "compression", "", "compression codec: none, gzip, snappy, lz4 or zstd (driver default if empty)")
+	flag.DurationVar(&opts.Linger, "linger", 0, "how long producer waits to fill a batch (driver default if not set)")
+	flag.IntVar(&opts.BatchSize, "batch_size", 0, "max messages in a producer batch (driver default if not set)")
+	flag.IntVar(&opts.BatchBytes, "batch_bytes", 0, "max producer batch size in bytes (driver default if not set)")
+	flag.IntVar(&opts.MaxInFlight, "max_in_flight", 0, "max in-flight produce requests (driver default if not set)")
+	flag.BoolVar(&opts.Idempotent, "idempotent", false, "enable idempotent producer (driver default if not set)")
+	flag.StringVar(&role, "role", roleBoth, "what to run: both, produce (consumers run elsewhere) or consume (start before producers, stops when their streams end or nothing arrives for drain timeout)")
+	flag.StringVar(&baselineFile, "baseline", "", "result document to compare to: checks \"baseline\" assertions of the scenario, or by default that throughput, P50 and P99 latency are within -baseline_tolerance and no more messages are missing")
+	flag.Float64Var(&tolerance, "baseline_tolerance", 0.05, "relative throughput and latency change allowed by default -baseline checks")
+	flag.StringVar(&scenarioFile, "scenario", "", "scenario file to run (see tests/*.json), only -brokers, -topics, -role, -hist_precision, -result -series and -baseline flags can be combined with it")
 	flag.Parse()
 
-	if url == "" {
-		log.Fatal("Provide at least one broker url")
+	var s Scenario
+	if scenarioFile != "" {
+		var err error
+		if s, err = loadScenario(scenarioFile); err != nil {
+			log.Fatalf("Invalid scenario: %v", err)
+		}
+		// Hosts running the same scenario may use their own brokers and topics.
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "scenario", "role", "hist_precision", "result", "series", "baseline", "baseline_tolerance":
+			case "brokers":
+				s.Brokers = strings.Split(url, ",")
+			case "topics":
+				if len(s.Groups) != 1 {
+					log.Fatalf("-topics can only override scenario with a single topic group, %s has %d", scenarioFile, len(s.Groups))
+				}
+				s.Groups[0].Topics = strings.Split(topics, ",")
+			default:
+				log.Fatalf("-%s can't be combined with -scenario, set it in the scenario file", f.Name)
+			}
+		})
+	} else {
+		if url == "" {
+			log.Fatal("Provide at least one broker url")
+		}
+
+		if (minutes != 0 && numMessages != 0) || (minutes == 0 && numMessages == 0) {
+			log.Fatal("Provide either -minutes or -num_messages, but not both.")
+		}
+
+		if sizeDist == "" {
+			sizeDist = fmt.Sprintf("fixed:%d", msgSize)
+		}
+		s = Scenario{
+			Driver:   broker,
+			Brokers:  strings.Split(url, ","),
+			Duration: duration(time.Duration(minutes) * time.Minute),
+			Messages: numMessages,
+			Drain:    duration(drain),
+			Cooldown: duration(cooldown),
+			Interval: duration(interval),
+			Payload:  payload,
+			Groups: []TopicGroup{{
+				Topics:    strings.Split(topics, ","),
+				Rate:      rate,
+				Schedule:  schedule,
+				Size:      sizeDist,
+				Keys:      keys,
+				Producers: producers,
+				Consumers: 1,
+			}},
+		}
+		// Driver defaults apply to options not set explicitly.
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "acks":
+				s.Options.Acks = &opts.Acks
+			case "compression":
+				s.Options.Compression = &opts.Compression
+			case "linger":
+				linger := duration(opts.Linger)
+				s.Options.Linger = &linger
+			case "batch_size":
+				s.Options.BatchSize = &opts.BatchSize
+			case "batch_bytes":
+				s.Options.BatchBytes = &opts.BatchBytes
+			case "max_in_flight":
+				s.Options.MaxInFlight = &opts.MaxInFlight
+			case "idempotent":
+				s.Options.Idempotent = &opts.Idempotent
+			case "warmup":
+				w := duration(warmup)
+				s.Warmup = &w
+			case "steady_window", "steady_tolerance":
+				s.SteadyState = &steady
+			}
+		})
 	}
 
-	if (minutes != 0 && numMessages != 0) || (minutes == 0 && numMessages == 0) {
-		log.Fatal("Provide either -minutes or -num_messages, but not both.")
+	if err := s.resolve(); err != nil {
+		log.Fatalf("Invalid benchmark settings: %v", err)
 	}
 
-	RunBench(ctx, msgSize, numMessages, minutes, rate, producers, broker, url, topics)
+	if precision < 1 || precision > maxPrecision {
+		log.Fatalf("-hist_precision must be in 1..%d range", maxPrecision)
+	}
+	switch role {
+	case roleBoth, roleProduce, roleConsume:
+	default:
+		log.Fatalf("Unknown -role %q (want both, produce or consume)", role)
+	}
+
+	cfg := s.config()
+	cfg.Role = role
+	cfg.Precision = precision
+	cfg.ResultFile = resultFile
+	cfg.SeriesFile = seriesFile
+	cfg.Assertions = s.assertions()
+	if baselineFile != "" {
+		var err error
+		if cfg.Baseline, cfg.Assertions, err = loadBaseline(baselineFile, tolerance, cfg.Assertions); err != nil {
+			log.Fatalf("Invalid baseline: %v", err)
+		}
+	}
+	result, err := RunBench(ctx, cfg)
+	if err != nil {
+		log.Fatalf("Run failed: %v", err)
+	}
+	if !assertionsPassed(result.Assertions) {
+		log.Fatal("Assertions failed")
+	}
 }
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"streambench/brokers"
+)
+
+// runMerge implements "merge" command.
+func runMerge(args []string) {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	out := fs.String("out", "merged.json", "file to write merged result document to (empty to skip)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s merge [flags] RESULT_FILE...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	names := make([]string, fs.NArg())
+	results := make([]Result, fs.NArg())
+	for i, path := range fs.Args() {
+		var err error
+		if results[i], err = readResult(path); err != nil {
+			log.Fatalf("Invalid result: %v", err)
+		}
+		names[i] = strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), ".json"), ".result")
+	}
+
+	merged, err := mergeResults(names, results)
+	if err != nil {
+		log.Fatalf("Merge failed: %v", err)
+	}
+	printResult(os.Stdout, merged)
+	if *out != "" {
+		if err := writeResult(*out, merged); err != nil {
+			log.Fatalf("failed to write result: %v", err)
+		}
+	}
+}
+
+// readResult reads result document written by a run.
+func readResult(path string) (Result, error) {
+	var res Result
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return res, err
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return res, fmt.Errorf("%s: %w", path, err)
+	}
+	if res.Schema != resultSchema {
+		return res, fmt.Errorf("%s: result schema %d is not supported (want %d)", path, res.Schema, resultSchema)
+	}
+	if res.Scenario == nil || res.Latencies == nil {
+		return res, fmt.Errorf("%s: scenario or latency histograms are missing", path)
+	}
+	return res, nil
+}
+
+// mergeResults merges results of several hosts or runs into one, counters are
+// summed and percentiles come from merged histograms.
+//
+// Results overlapping in time are hosts of one run: the merged result spans
+// the window all of them ran in, and throughput is what their time series
+// counted in that window. Otherwise results
+// are repeated runs and throughput is averaged over their total duration.
+//
+// A producer is known to the host that ran it and to hosts that consumed its
+// messages, its counts are taken from the producing host and what consumers
+// measured is added up.
+func mergeResults(names []string, results []Result) (Result, error) {
+	first := results[0]
+	m := Result{
+		Schema:      resultSchema,
+		Scenario:    mergeScenarios(results),
+		Environment: newEnvironment(),
+		Start:       first.Start,
+		End:         first.End,
+		Payload:     first.Payload,
+		Window:      first.Window,
+		Latencies:   newProducerLatencies(first.Latencies.Latency.precision),
+		Drained:     true,
+	}
+
+	produce, consume := false, false
+	var total time.Duration
+	for i, res := range results {
+		produce = produce || res.Role != roleConsume
+		consume = consume || res.Role != roleProduce
+		if res.Start.After(m.Start) {
+			m.Start = res.Start
+		}
+		if res.End.Before(m.End) {
+			m.End = res.End
+		}
+		total += time.Duration(res.Elapsed)
+		// Merged latencies are steady once all hosts are.
+		if res.Window.SteadyAt == 0 || m.Window.SteadyAt != 0 && res.Window.SteadyAt > m.Window.SteadyAt {
+			m.Window.SteadyAt = res.Window.SteadyAt
+		}
+		if err := m.Latencies.merge(res.Latencies); err != nil {
+			return m, fmt.Errorf("%s: %w", names[i], err)
+		}
+		m.Hosts = append(m.Hosts, newHostSummary(names[i], res))
+	}
+	switch {
+	case produce && !consume:
+		m.Role = roleProduce
+	case consume && !produce:
+		m.Role = roleConsume
+	default:
+		m.Role = roleBoth
+	}
+	concurrent := m.End.After(m.Start)
+	if concurrent {
+		m.Elapsed = duration(m.End.Sub(m.Start))
+	} else {
+		m.Start, m.End = first.Start, first.End
+		for _, res := range results {
+			if res.Start.Before(m.Start) {
+				m.Start = res.Start
+			}
+			if res.End.After(m.End) {
+				m.End = res.End
+			}
+		}
+		m.Elapsed = duration(total)
+	}
+	m.Percentiles = newLatencyPercentiles(m.Latencies)
+
+	sizes, err := mergeSizes(results)
+	if err != nil {
+		return m, err
+	}
+	m.Sizes = sizes
+
+	topics, err := mergeTopics(results, concurrent, first.Latencies.Latency.precision)
+	if err != nil {
+		return m, err
+	}
+	for _, t := range topics {
+		m.addTopic(t)
+	}
+
+	if concurrent {
+		if !m.windowThroughput(results) {
+			// Without time series host rates add up instead.
+			m.ApproxThroughput = true
+			for _, res := range results {
+				if res.Role != roleConsume {
+					m.ProduceThroughput += res.ProduceThroughput
+				}
+				m.Throughput += res.Throughput
+				m.DataThroughput += res.DataThroughput
+			}
+		}
+	} else {
+		m.ProduceThroughput = float64(m.Produced) / total.Seconds()
+		m.Throughput = float64(m.Consumed) / total.Seconds()
+		m.DataThroughput = float64(m.ConsumedBytes) / total.Seconds() / 1024 / 1024
+	}
+
+	return m, nil
+}
+
+// windowThroughput sets throughput to what all results counted in the
+// common time window, it returns false if some result has no time series.
+func (m *Result) windowThroughput(results []Result) bool {
+	var acked, consumed, bytes float64
+	for _, res := range results {
+		a, c, b, ok := windowCounts(res, m.Start, m.End)
+		if !ok {
+			return false
+		}
+		// Consumers know producer counts from end markers, only the producing host counts them.
+		if res.Role != roleConsume {
+			acked += a
+		}
+		consumed += c
+		bytes += b
+	}
+	window := time.Duration(m.Elapsed).Seconds()
+	m.ProduceThroughput = acked / window
+	m.Throughput = consumed / window
+	m.DataThroughput = bytes / window / 1024 / 1024
+	return true
+}
+
+// windowCounts returns acknowledged and consumed messages and consumed bytes
+// of result time series within [from, to), intervals crossing the bounds
+// count in proportion to their overlap. It returns false without series.
+func windowCounts(res Result, from, to time.Time) (acked, consumed, bytes float64, ok bool) {
+	s := res.Series
+	if s == nil || s.Interval <= 0 {
+		return 0, 0, 0, false
+	}
+	for _, p := range s.Points {
+		start := res.Start.Add(time.Duration(p.Start))
+		end := start.Add(time.Duration(s.Interval))
+		if end.After(res.End) {
+			end = res.End // The last interval is cut short.
+		}
+		lo, hi := start, end
+		if from.After(lo) {
+			lo = from
+		}
+		if to.Before(hi) {
+			hi = to
+		}
+		if !hi.After(lo) {
+			continue
+		}
+		share := float64(hi.Sub(lo)) / float64(end.Sub(start))
+		acked += share * float64(p.Acked)
+		consumed += share * float64(p.Consumed)
+		bytes += share * float64(p.ConsumedBytes)
+	}
+	return acked, consumed, bytes, true
+}
+
+func newHostSummary(name string, res Result) HostSummary {
+	return HostSummary{
+		Name:              name,
+		Hostname:          res.Environment.Hostname,
+		RunID:             res.RunID,
+		Role:              res.Role,
+		Clock:             res.Clock,
+		Start:             res.Start,
+		End:               res.End,
+		Elapsed:           res.Elapsed,
+		Produced:          res.Produced,
+		Consumed:          res.Consumed,
+		ProduceThroughput: res.ProduceThroughput,
+		Throughput:        res.Throughput,
+		DataThroughput:    res.DataThroughput,
+		Percentiles:       res.Percentiles,
+		Errors:            res.Errors,
+	}
+}
+
+// mergeScenarios returns scenario of the first result with topics of all of
+// them, hosts usually run the same scenario on their own topics.
+func mergeScenarios(results []Result) *Scenario {
+	s := *results[0].Scenario
+	s.Groups = append([]TopicGroup(nil), s.Groups...)
+	for _, res := range results[1:] {
+		for _, g := range res.Scenario.Groups {
+			for i := range s.Groups {
+				if s.Groups[i].Name != g.Name {
+					continue
+				}
+				for _, topic := range g.Topics {
+					if !contains(s.Groups[i].Topics, topic) {
+						s.Groups[i].Topics = append(append([]string(nil), s.Groups[i].Topics...), topic)
+					}
+				}
+			}
+		}
+	}
+	return &s
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeSizes merges latency of message size buckets.
+func mergeSizes(results []Result) ([]SizeSummary, error) {
+	buckets := make(map[int]*SizeSummary)
+	for _, res := range results {
+		for _, s := range res.Sizes {
+			if s.Histogram == nil {
+				return nil, fmt.Errorf("run %s: size bucket %s histogram is missing", res.RunID, s.Bucket)
+			}
+			b, ok := buckets[s.MaxSize]
+			if !ok {
+				b = &SizeSummary{Bucket: s.Bucket, MaxSize: s.MaxSize, Histogram: NewHistogram(s.Histogram.precision)}
+				buckets[s.MaxSize] = b
+			}
+			if err := b.Histogram.Merge(s.Histogram); err != nil {
+				return nil, fmt.Errorf("run %s: %w", res.RunID, err)
+			}
+		}
+	}
+
+	var sizes []SizeSummary
+	for _, b := range buckets {
+		b.Latency = newPercentilesCI(b.Histogram)
+		sizes = append(sizes, *b)
+	}
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i].MaxSize < sizes[j].MaxSize })
+	return sizes, nil
+}
+
+// mergeTopics merges topic summaries of the same topic, ordered by topic.
+func mergeTopics(results []Result, concurrent bool, precision int) ([]TopicSummary, error) {
+	copies := make(map[string][]TopicSummary)
+	owners := make(map[string][]string) // Run id of the result each copy comes from.
+	var names []string
+	for _, res := range results {
+		for _, t := range res.Topics {
+			if _, ok := copies[t.Topic]; !ok {
+				names = append(names, t.Topic)
+			}
+			copies[t.Topic] = append(copies[t.Topic], t)
+			owners[t.Topic] = append(owners[t.Topic], res.RunID)
+		}
+	}
+	sort.Strings(names)
+
+	topics := make([]TopicSummary, 0, len(names))
+	for _, name := range names {
+		t, err := mergeTopic(copies[name], owners[name], concurrent, precision)
+		if err != nil {
+			return nil, fmt.Errorf("topic %s: %w", name, err)
+		}
+		topics = append(topics, t)
+	}
+	return topics, nil
+}
+
+func mergeTopic(copies []TopicSummary, runIDs []string, concurrent bool, precision int) (TopicSummary, error) {
+	first := copies[0]
+	t := TopicSummary{
+		topicAudit:    topicAudit{Topic: first.Topic, Drained: true},
+		Group:         first.Group,
+		TimestampType: first.TimestampType,
+	}
+
+	partitions := make(map[int32]*PartitionSummary)
+	producers := make(map[string]*ProducerSummary)
+	owned := make(map[string]bool)
+	var elapsed time.Duration
+	for i, c := range copies {
+		t.Consumed += c.Consumed
+		t.ConsumedBytes += c.ConsumedBytes
+		t.Drained = t.Drained && c.Drained
+		if c.DrainTime > t.DrainTime {
+			t.DrainTime = c.DrainTime
+		}
+		if c.Elapsed > t.Elapsed {
+			t.Elapsed = c.Elapsed
+		}
+		elapsed += time.Duration(c.Elapsed)
+		if concurrent {
+			t.Throughput += c.Throughput
+			t.DataThroughput += c.DataThroughput
+		}
+		if c.Consumed > 0 && c.TimestampType != brokers.TimestampUnknown.String() {
+			t.TimestampType = c.TimestampType
+		}
+
+		for _, ps := range c.Partitions {
+			if ps.Histogram == nil {
+				return t, fmt.Errorf("partition %d histogram is missing", ps.Partition)
+			}
+			p, ok := partitions[ps.Partition]
+			if !ok {
+				p = &PartitionSummary{Partition: ps.Partition, Histogram: NewHistogram(ps.Histogram.precision)}
+				partitions[ps.Partition] = p
+			}
+			p.Received += ps.Received
+			if err := p.Histogram.Merge(ps.Histogram); err != nil {
+				return t, err
+			}
+		}
+
+		for _, ps := range c.Producers {
+			if ps.Latencies == nil {
+				return t, fmt.Errorf("producer %s/%d histograms are missing", ps.RunID, ps.ID)
+			}
+			key := fmt.Sprintf("%s/%d", ps.RunID, ps.ID)
+			p, ok := producers[key]
+			if !ok {
+				p = &ProducerSummary{RunID: ps.RunID, ID: ps.ID, Latencies: newProducerLatencies(precision)}
+				producers[key] = p
+			}
+			// Producing host knows the counts best, consumers learn them from the end marker.
+			if own := ps.RunID == runIDs[i]; own || !owned[key] && ps.Elapsed > 0 {
+				owned[key] = owned[key] || own
+				p.Produced, p.Acked, p.Failed = ps.Produced, ps.Acked, ps.Failed
+				p.Elapsed, p.Throughput, p.Lag, p.MaxLag = ps.Elapsed, ps.Throughput, ps.Lag, ps.MaxLag
+			}
+			p.Received += ps.Received
+			p.Missing += ps.Missing
+			p.HeadMissing += ps.HeadMissing
+			p.Gaps += ps.Gaps
+			p.Duplicates += ps.Duplicates
+			p.Reordered += ps.Reordered
+			if err := p.Latencies.merge(ps.Latencies); err != nil {
+				return t, err
+			}
+		}
+	}
+	if !concurrent && elapsed > 0 {
+		t.Throughput = float64(t.Consumed) / elapsed.Seconds()
+		t.DataThroughput = float64(t.ConsumedBytes) / elapsed.Seconds() / 1024 / 1024
+	}
+
+	for _, p := range partitions {
+		p.Latency = newPercentilesCI(p.Histogram)
+		t.Partitions = append(t.Partitions, *p)
+	}
+	sort.Slice(t.Partitions, func(i, j int) bool { return t.Partitions[i].Partition < t.Partitions[j].Partition })
+
+	latencies := newProducerLatencies(precision)
+	for _, p := range producers {
+		p.Percentiles = newLatencyPercentiles(p.Latencies)
+		if p.Elapsed > 0 {
+			p.Delivered = float64(p.Received) / time.Duration(p.Elapsed).Seconds()
+		}
+		if err := latencies.merge(p.Latencies); err != nil {
+			return t, err
+		}
+		t.Produced += p.Produced
+		t.Acked += p.Acked
+		t.Missing += p.Missing
+		t.HeadMissing += p.HeadMissing
+		t.Duplicated += p.Duplicates
+		t.Producers = append(t.Producers, *p)
+	}
+	sort.Slice(t.Producers, func(i, j int) bool {
+		a, b := t.Producers[i], t.Producers[j]
+		return a.RunID < b.RunID || a.RunID == b.RunID && a.ID < b.ID
+	})
+	t.Percentiles = newLatencyPercentiles(latencies)
+	t.Fairness = producersFairness(t.Producers)
+
+	return t, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// hostRun is what a host measured for producer stream 0 of topic t0.
+type hostRun struct {
+	runID    string
+	role     string
+	start    time.Time
+	elapsed  time.Duration
+	producer string // Run id of the producing host.
+	produced uint64
+	received uint64
+	missing  uint64
+	values   []int64 // Latencies in microseconds.
+	series   bool    // Keep per second time series.
+}
+
+// result returns result document of the host run.
+func (h hostRun) result(precision int) Result {
+	latencies := newProducerLatencies(precision)
+	partition := NewHistogram(precision)
+	for _, v := range h.values {
+		latencies.Latency.RecordValue(v, 1)
+		partition.RecordValue(v, 1)
+	}
+	p := ProducerSummary{RunID: h.producer, ID: 0, Produced: h.produced, Acked: h.produced, Received: h.received,
+		Missing: h.missing, Elapsed: duration(h.elapsed), Latencies: latencies}
+	t := TopicSummary{
+		topicAudit: topicAudit{Topic: "t0", Produced: h.produced, Acked: h.produced, Consumed: h.received, Missing: h.missing, Drained: true},
+		Group:      "main",
+		Elapsed:    duration(h.elapsed),
+		Producers:  []ProducerSummary{p},
+	}
+	if h.received > 0 {
+		t.Partitions = []PartitionSummary{{Partition: 0, Received: h.received, Histogram: partition}}
+	}
+	res := Result{
+		Schema:    resultSchema,
+		RunID:     h.runID,
+		Role:      h.role,
+		Scenario:  &Scenario{Groups: []TopicGroup{{Name: "main", Topics: []string{"t0"}}}},
+		Start:     h.start,
+		End:       h.start.Add(h.elapsed),
+		Elapsed:   duration(h.elapsed),
+		Latencies: latencies,
+		Drained:   true,
+	}
+	res.Percentiles = newLatencyPercentiles(latencies)
+	res.addTopic(t)
+	res.Throughput = float64(res.Consumed) / h.elapsed.Seconds()
+	res.ProduceThroughput = float64(res.Produced) / h.elapsed.Seconds()
+	if h.series {
+		res.Series = &Series{Interval: duration(time.Second)}
+		seconds := uint64(h.elapsed / time.Second)
+		for i := uint64(0); i < seconds; i++ {
+			pt := SeriesPoint{Start: duration(time.Duration(i) * time.Second), Consumed: h.received / seconds}
+			if h.role != roleConsume {
+				pt.Acked = h.produced / seconds
+			}
+			res.Series.Points = append(res.Series.Points, pt)
+		}
+	}
+	return res
+}
+
+func TestMergeRepeatedRuns(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := hostRun{runID: "a", role: roleBoth, start: start, elapsed: 10 * time.Second, producer: "a",
+		produced: 1000, received: 1000, values: latencySample(1, 1000)}
+	b := hostRun{runID: "b", role: roleBoth, start: start.Add(time.Hour), elapsed: 10 * time.Second, producer: "b",
+		produced: 3000, received: 2998, missing: 2, values: latencySample(2, 2998)}
+
+	m, err := mergeResults([]string{"a", "b"}, []Result{a.result(3), b.result(3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Duration(m.Elapsed) != 20*time.Second || m.Throughput != 3998.0/20 || m.ApproxThroughput {
+		t.Errorf("elapsed %v, throughput %v (approximate %v), want runs time and rate averaged over it", time.Duration(m.Elapsed), m.Throughput, m.ApproxThroughput)
+	}
+	if m.Produced != 4000 || m.Consumed != 3998 || m.Errors.Missing != 2 || len(m.Hosts) != 2 {
+		t.Errorf("produced %d, consumed %d, missing %d, %d hosts", m.Produced, m.Consumed, m.Errors.Missing, len(m.Hosts))
+	}
+
+	// Percentiles are exact: the same as of all values recorded together.
+	all := NewHistogram(3)
+	for _, v := range append(a.values, b.values...) {
+		all.RecordValue(v, 1)
+	}
+	if want := newPercentiles(all); m.Percentiles.Latency.P99 != want.P99 || m.Percentiles.Latency.Count != want.Count {
+		t.Errorf("merged P99 %v of %d, want %v of %d", m.Percentiles.Latency.P99, m.Percentiles.Latency.Count, want.P99, want.Count)
+	}
+	if len(m.Topics) != 1 || len(m.Topics[0].Producers) != 2 || m.Topics[0].Partitions[0].Received != 3998 {
+		t.Errorf("topics %+v, want t0 with two producer streams and a merged partition", m.Topics)
+	}
+}
+
+func TestMergeSplitRoles(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, series := range []bool{false, true} {
+		producer := hostRun{runID: "p", role: roleProduce, start: start, elapsed: 10 * time.Second, producer: "p",
+			produced: 1000, series: series}
+		// Consumer learns producer counts from the end marker.
+		consumer := hostRun{runID: "c", role: roleConsume, start: start, elapsed: 10 * time.Second, producer: "p",
+			produced: 1000, received: 990, missing: 10, values: latencySample(1, 990), series: series}
+
+		m, err := mergeResults([]string{"producer", "consumer"}, []Result{producer.result(3), consumer.result(3)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Role != roleBoth || m.Produced != 1000 || m.Consumed != 990 || m.Errors.Missing != 10 {
+			t.Errorf("series %v: role %s, produced %d, consumed %d, missing %d", series, m.Role, m.Produced, m.Consumed, m.Errors.Missing)
+		}
+		p := m.Topics[0].Producers
+		if len(p) != 1 || p[0].Produced != 1000 || p[0].Received != 990 {
+			t.Errorf("series %v: producers %+v, want one stream seen by both hosts", series, p)
+		}
+		if m.ApproxThroughput == series {
+			t.Errorf("series %v: approximate throughput %v", series, m.ApproxThroughput)
+		}
+		if m.ProduceThroughput != 100 || m.Throughput != 99 {
+			t.Errorf("series %v: produce throughput %v, throughput %v, want 100 and 99", series, m.ProduceThroughput, m.Throughput)
+		}
+	}
+}
+
+func TestMergePrecisionMismatch(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := hostRun{runID: "a", role: roleBoth, start: start, elapsed: time.Second, producer: "a", produced: 1, received: 1, values: []int64{100}}
+	b := a
+	b.runID, b.producer = "b", "b"
+	_, err := mergeResults([]string{"a", "b"}, []Result{a.result(3), b.result(2)})
+	if err == nil || !strings.Contains(err.Error(), "precision") {
+		t.Errorf("got %v, want precision mismatch error", err)
+	}
+}
+
+func TestReadResult(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, v any) string {
+		path := filepath.Join(dir, name)
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	h := hostRun{runID: "a", role: roleBoth, start: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), elapsed: time.Second,
+		producer: "a", produced: 10, received: 10, values: latencySample(1, 10)}
+	res := h.result(3)
+	got, err := readResult(write("ok.json", res))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Latencies.Latency.Count() != 10 || got.Topics[0].Producers[0].Received != 10 {
+		t.Errorf("read result lost histograms or counters: %+v", got)
+	}
+
+	old := res
+	old.Schema = resultSchema - 1
+	noScenario := res
+	noScenario.Scenario = nil
+	for name, v := range map[string]any{"schema": old, "scenario": noScenario, "not a result": []int{1}} {
+		if _, err := readResult(write(name+".json", v)); err == nil {
+			t.Errorf("%s: result accepted", name)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Payload generators.
+const (
+	payloadFill   = "fill"   // The same byte repeated (compresses to almost nothing).
+	payloadRandom = "random" // Incompressible random bytes.
+	payloadText   = "text"   // English-like text with a target compression ratio.
+	payloadJSON   = "json"   // JSON records generated from a template.
+	payloadCorpus = "corpus" // Chunks sampled from a user supplied file.
+)
+
+// PayloadConfig selects and tunes payload generator.
+type PayloadConfig struct {
+	Kind     string  `json:"kind"`
+	Seed     int64   `json:"seed"`               // Also seeds message sizes and keys.
+	Ratio    float64 `json:"ratio,omitempty"`    // Target compression ratio for text payload.
+	Template string  `json:"template,omitempty"` // JSON template file for json payload (built-in template if empty).
+	Corpus   string  `json:"corpus,omitempty"`   // Source file for corpus payload.
+}
+
+// payloadPoolSize is how many bytes are generated up front.
+const payloadPoolSize = 4 << 20
+
+// payloadPool is pre-generated message filler. Messages are cut from it
+// at rotating offsets, so the producer hot path only copies bytes.
+type payloadPool struct {
+	name string // Generator description for result metadata.
+	buf  []byte
+}
+
+// payloadCursor is a per producer read position in the pool.
+type payloadCursor struct {
+	pool *payloadPool
+	off  int
+}
+
+func (p *payloadPool) cursor(seed int64) *payloadCursor {
+	return &payloadCursor{pool: p, off: int(uint64(seed) % uint64(len(p.buf)))}
+}
+
+// appendTo appends n payload bytes to b.
+func (c *payloadCursor) appendTo(b []byte, n int) []byte {
+	buf := c.pool.buf
+	for n > 0 {
+		chunk := buf[c.off:]
+		if len(chunk) > n {
+			chunk = chunk[:n]
+		}
+		b = append(b, chunk...)
+		n -= len(chunk)
+		c.off = (c.off + len(chunk)) % len(buf)
+	}
+
+	return b
+}
+
+func newPayloadPool(cfg PayloadConfig, maxSize int) (*payloadPool, error) {
+	size := payloadPoolSize
+	if size < 4*maxSize {
+		size = 4 * maxSize
+	}
+	rnd := rand.New(rand.NewSource(cfg.Seed))
+
+	p := &payloadPool{}
+	switch cfg.Kind {
+	case payloadFill:
+		p.name = "fill"
+		p.buf = bytes.Repeat([]byte{42}, size)
+	case payloadRandom:
+		p.name = fmt.Sprintf("random (seed %d)", cfg.Seed)
+		p.buf = make([]byte, size)
+		rnd.Read(p.buf)
+	case payloadText:
+		buf, ratio := calibratedText(rnd, size, cfg.Ratio)
+		p.name = fmt.Sprintf("text (seed %d, target compression ratio %.2f, actual %.2f)", cfg.Seed, cfg.Ratio, ratio)
+		p.buf = buf
+	case payloadJSON:
+		tmpl := defaultJSONTemplate
+		name := "built-in"
+		if cfg.Template != "" {
+			b, err := os.ReadFile(cfg.Template)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read JSON template: %w", err)
+			}
+			tmpl, name = strings.TrimSpace(string(b)), cfg.Template
+		}
+		buf, err := jsonRecords(rnd, size, tmpl)
+		if err != nil {
+			return nil, err
+		}
+		p.name = fmt.Sprintf("json (seed %d, template %s)", cfg.Seed, name)
+		p.buf = buf
+	case payloadCorpus:
+		corpus, err := os.ReadFile(cfg.Corpus)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read payload corpus: %w", err)
+		}
+		if len(corpus) == 0 {
+			return nil, fmt.Errorf("payload corpus %s is empty", cfg.Corpus)
+		}
+		p.name = fmt.Sprintf("corpus (seed %d, file %s)", cfg.Seed, cfg.Corpus)
+		p.buf = sampleCorpus(rnd, size, corpus)
+	default:
+		return nil, fmt.Errorf("unknown payload generator %q", cfg.Kind)
+	}
+
+	return p, nil
+}
+
+// sampleCorpus concatenates randomly picked corpus chunks.
+func sampleCorpus(rnd *rand.Rand, size int, corpus []byte) []byte {
+	const chunk = 4096
+	buf := make([]byte, 0, size)
+	for len(buf) < size {
+		n := chunk
+		if n > len(corpus) {
+			n = len(corpus)
+		}
+		if n > size-len(buf) {
+			n = size - len(buf)
+		}
+		off := rnd.Intn(len(corpus) - n + 1)
+		buf = append(buf, corpus[off:off+n]...)
+	}
+
+	return buf
+}
+
+var textWords = strings.Fields(`the of and to in is was that for it with as his on be at by had are
+but from or have an they which one you were her all she there would their we him been has when who
+will more no if out so said what up its about into than them can only other new some could time these
+two may then do first any my now such like our over man me even most made after also did many before
+must through back years where much your way well down should because each just those people how too
+little state good very make world still own see men work long get here between both life being under
+never day same another know while last might us great old year off come since against go came right
+used take three market order price stream broker message latency partition replica leader commit offset`)
+
+// calibratedText generates text which compresses (with deflate) about ratio times.
+// Text is a mix of dictionary words (compress well) and random letter
+// sequences (compress poorly), for higher ratios the dictionary shrinks instead.
+// The mix is tuned with binary search on a sample.
+func calibratedText(rnd *rand.Rand, size int, ratio float64) ([]byte, float64) {
+	const sample = 256 << 10
+	seed := rnd.Int63()
+	// entropy in [0, 1]: below 0.5 it grows vocabulary, above 0.5 it adds noise words.
+	gen := func(n int, entropy float64) []byte {
+		r := rand.New(rand.NewSource(seed))
+		vocab, noise := len(textWords), 2*entropy-1
+		if entropy < 0.5 {
+			vocab, noise = 1+int(2*entropy*float64(len(textWords)-1)), 0
+		}
+		var b bytes.Buffer
+		b.Grow(n + 16)
+		for b.Len() < n {
+			if r.Float64() < noise {
+				for i := 3 + r.Intn(7); i > 0; i-- {
+					b.WriteByte(byte('a' + r.Intn(26)))
+				}
+			} else {
+				b.WriteString(textWords[r.Intn(vocab)])
+			}
+			if r.Intn(12) == 0 {
+				b.WriteString(". ")
+			} else {
+				b.WriteByte(' ')
+			}
+		}
+		return b.Bytes()[:n]
+	}
+
+	lo, hi := 0.0, 1.0
+	entropy := 0.5
+	for i := 0; i < 16; i++ {
+		entropy = (lo + hi) / 2
+		actual := compressionRatio(gen(sample, entropy))
+		if math.Abs(actual-ratio) < 0.01 {
+			break
+		}
+		if actual > ratio {
+			lo = entropy
+		} else {
+			hi = entropy
+		}
+	}
+
+	buf := gen(size, entropy)
+	actual := compressionRatio(buf[:sample])
+	if math.Abs(actual-ratio)/ratio > 0.1 {
+		log.Printf("Text payload compression ratio %.2f is far from requested %.2f", actual, ratio)
+	}
+
+	return buf, actual
+}
+
+func compressionRatio(b []byte) float64 {
+	var out bytes.Buffer
+	w, _ := flate.NewWriter(&out, flate.DefaultCompression)
+	w.Write(b)
+	w.Close()
+	return float64(len(b)) / float64(out.Len())
+}
+
+const defaultJSONTemplate = `{"id":"{{uuid}}","seq":{{seq}},"ts":"{{timestamp}}","user_id":{{int}},` +
+	`"symbol":"{{word}}","side":"{{word}}","price":{{float}},"qty":{{int}},"active":{{bool}},"note":"{{string}}"}`
+
+// jsonRecords fills buffer with newline separated records generated from template.
+// Supported placeholders: {{uuid}}, {{seq}}, {{timestamp}}, {{int}}, {{float}},
+// {{bool}}, {{word}} and {{string}}.
+func jsonRecords(rnd *rand.Rand, size int, tmpl string) ([]byte, error) {
+	parts := strings.Split(tmpl, "{{")
+	buf := make([]byte, 0, size+len(tmpl)*2)
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	for seq := 0; len(buf) < size; seq++ {
+		buf = append(buf, parts[0]...)
+		for _, part := range parts[1:] {
+			end := strings.Index(part, "}}")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated placeholder in JSON template: {{%s", part)
+			}
+			switch part[:end] {
+			case "uuid":
+				buf = fmt.Appendf(buf, "%08x-%04x-%04x-%04x-%012x",
+					rnd.Uint32(), rnd.Intn(1<<16), rnd.Intn(1<<16), rnd.Intn(1<<16), rnd.Int63n(1<<48))
+			case "seq":
+				buf = strconv.AppendInt(buf, int64(seq), 10)
+			case "timestamp":
+				ts = ts.Add(time.Duration(rnd.Intn(1000)) * time.Millisecond)
+				buf = ts.AppendFormat(buf, time.RFC3339Nano)
+			case "int":
+				buf = strconv.AppendInt(buf, rnd.Int63n(1000000), 10)
+			case "float":
+				buf = strconv.AppendFloat(buf, rnd.Float64()*1000, 'f', 2, 64)
+			case "bool":
+				buf = strconv.AppendBool(buf, rnd.Intn(2) == 0)
+			case "word":
+				buf = append(buf, textWords[rnd.Intn(len(textWords))]...)
+			case "string":
+				for i := 3 + rnd.Intn(5); i > 0; i-- {
+					buf = append(buf, textWords[rnd.Intn(len(textWords))]...)
+					buf = append(buf, ' ')
+				}
+				buf = buf[:len(buf)-1]
+			default:
+				return nil, fmt.Errorf("unknown JSON template placeholder {{%s}}", part[:end])
+			}
+			buf = append(buf, part[end+2:]...)
+		}
+		buf = append(buf, '\n')
+	}
+
+	return buf[:size], nil
+}
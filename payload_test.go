@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPayloadPool(t *testing.T) {
+	corpus := filepath.Join(t.TempDir(), "corpus.txt")
+	if err := os.WriteFile(corpus, []byte(strings.Repeat("abcdefghij", 1000)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, cfg := range []PayloadConfig{
+		{Kind: payloadFill, Seed: 1},
+		{Kind: payloadRandom, Seed: 1},
+		{Kind: payloadText, Seed: 1, Ratio: 3},
+		{Kind: payloadJSON, Seed: 1},
+		{Kind: payloadCorpus, Seed: 1, Corpus: corpus},
+	} {
+		t.Run(cfg.Kind, func(t *testing.T) {
+			p, err := newPayloadPool(cfg, 1<<20)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(p.buf) < 4<<20 {
+				t.Errorf("pool of %d bytes, want at least 4 times the largest message", len(p.buf))
+			}
+			again, err := newPayloadPool(cfg, 1<<20)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(p.buf, again.buf) {
+				t.Errorf("pools of the same seed differ")
+			}
+		})
+	}
+}
+
+func TestPayloadCompression(t *testing.T) {
+	random, err := newPayloadPool(PayloadConfig{Kind: payloadRandom, Seed: 1}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := compressionRatio(random.buf[:1<<20]); r > 1.01 {
+		t.Errorf("random payload compresses %.2f times, want incompressible", r)
+	}
+
+	for _, ratio := range []float64{2, 3, 5} {
+		text, err := newPayloadPool(PayloadConfig{Kind: payloadText, Seed: 1, Ratio: ratio}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r := compressionRatio(text.buf[:1<<20]); math.Abs(r-ratio)/ratio > 0.1 {
+			t.Errorf("text payload compresses %.2f times, want %.2f", r, ratio)
+		}
+	}
+}
+
+func TestPayloadJSON(t *testing.T) {
+	p, err := newPayloadPool(PayloadConfig{Kind: payloadJSON, Seed: 1}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(p.buf, []byte("\n"))
+	for i, line := range lines[:len(lines)-1] { // The last one is cut.
+		var record map[string]any
+		if err := json.Unmarshal(line, &record); err != nil {
+			t.Fatalf("record %d %q: %v", i, line, err)
+		}
+		if record["seq"] != float64(i) {
+			t.Fatalf("record %d has seq %v", i, record["seq"])
+		}
+	}
+
+	if _, err := jsonRecords(nil, 10, `{"a":{{nope}}}`); err == nil {
+		t.Errorf("unknown placeholder accepted")
+	}
+	if _, err := jsonRecords(nil, 10, `{"a":{{int`); err == nil {
+		t.Errorf("unterminated placeholder accepted")
+	}
+}
+
+func TestPayloadCursor(t *testing.T) {
+	p := &payloadPool{buf: []byte("0123456789")}
+	c := p.cursor(7)
+	if got := string(c.appendTo([]byte("x"), 5)); got != "x78901" {
+		t.Errorf("got %q, want wrapped around x78901", got)
+	}
+	if got := string(c.appendTo(nil, 23)); got != "23456789012345678901234" {
+		t.Errorf("got %q, want the pool repeated from the last offset", got)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setting is a scenario setting shown in a report.
+type setting struct {
+	name  string
+	value string
+}
+
+// runReport implements "report" command.
+func runReport(args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	out := fs.String("out", "", "file to write Markdown report to (stdout if empty)")
+	title := fs.String("title", "", "report heading (none if empty)")
+	labels := fs.String("labels", "", "comma separated column labels, one per result (taken from result scenarios if empty)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s report [flags] RESULT_FILE...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	names := make([]string, fs.NArg())
+	results := make([]Result, fs.NArg())
+	for i, path := range fs.Args() {
+		var err error
+		if results[i], err = readResult(path); err != nil {
+			log.Fatalf("Invalid result: %v", err)
+		}
+		names[i] = strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), ".json"), ".result")
+	}
+	if *labels != "" {
+		names = strings.Split(*labels, ",")
+		if len(names) != len(results) {
+			log.Fatalf("-labels has %d labels for %d results", len(names), len(results))
+		}
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatalf("failed to create report: %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	printReport(w, *title, names, results, *labels != "")
+}
+
+// printReport renders results as a Markdown table, a column per result,
+// under a list of scenario settings they share. Settings that differ
+// are table rows. Columns are labeled by what tells results apart
+// unless labeled explicitly.
+func printReport(w io.Writer, title string, names []string, results []Result, labeled bool) {
+	settings := make([][]setting, len(results))
+	for i, res := range results {
+		settings[i] = reportSettings(res)
+	}
+	var common, differ []int // Indexes of settings.
+	for j, s := range settings[0] {
+		same := true
+		for _, other := range settings[1:] {
+			same = same && j < len(other) && other[j] == s
+		}
+		if same {
+			common = append(common, j)
+		} else {
+			differ = append(differ, j)
+		}
+	}
+	if !labeled {
+		names = reportLabels(names, results, settings, differ)
+	}
+
+	if title != "" {
+		fmt.Fprintf(w, "## %s\n\n", title)
+	}
+	if len(common) > 0 {
+		fmt.Fprintln(w, "Setup is:")
+		for _, j := range common {
+			if settings[0][j].value == "" {
+				continue
+			}
+			fmt.Fprintf(w, "* %s: %s\n", settings[0][j].name, settings[0][j].value)
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "|  | %s |\n", strings.Join(names, " | "))
+	fmt.Fprintf(w, "| --- |%s\n", strings.Repeat(" --- |", len(results)))
+	row := func(name string, value func(i int, res Result) string) {
+		cells := make([]string, len(results))
+		for i, res := range results {
+			cells[i] = value(i, res)
+		}
+		fmt.Fprintf(w, "| %s | %s |\n", name, strings.Join(cells, " | "))
+	}
+	for _, j := range differ {
+		row(settings[0][j].name, func(i int, _ Result) string {
+			if j < len(settings[i]) {
+				return settings[i][j].value
+			}
+			return "-"
+		})
+	}
+	row("Message throughput (msg per sec)", func(_ int, res Result) string { return fmt.Sprintf("%.2f", res.Throughput) })
+	row("Data throughput (Mb per sec)", func(_ int, res Result) string { return fmt.Sprintf("%f", res.DataThroughput) })
+	latency := func(name string, v func(Percentiles) float64) {
+		row(name+" latency (ms)", func(_ int, res Result) string {
+			if res.Percentiles.Latency.Count == 0 {
+				return "-"
+			}
+			return strconv.FormatInt(int64(v(res.Percentiles.Latency)), 10) // Whole milliseconds, like ms.
+		})
+	}
+	latency("Min", func(p Percentiles) float64 { return p.Min })
+	latency("P90", func(p Percentiles) float64 { return p.P90 })
+	latency("P99", func(p Percentiles) float64 { return p.P99 })
+	latency("P99.9", func(p Percentiles) float64 { return p.P999 })
+	latency("Max", func(p Percentiles) float64 { return p.Max })
+}
+
+// reportSettings describes scenario of result, settings of every result
+// line up as long as scenarios have the same number of topic groups.
+func reportSettings(res Result) []setting {
+	s := res.Scenario
+	opts := s.Options.resolve(s.Driver)
+	num := func(n int) string {
+		if n == 0 {
+			return "default"
+		}
+		return strconv.Itoa(n)
+	}
+	settings := []setting{
+		{"Scenario", s.Name},
+		{"Driver", s.Driver},
+		{"Brokers", strconv.Itoa(len(s.Brokers))},
+		{"Acks", opts.Acks},
+		{"Compression", opts.Compression},
+		{"Linger", opts.Linger.String()},
+		{"Batch size", num(opts.BatchSize)},
+		{"Batch bytes", num(opts.BatchBytes)},
+		{"Max in-flight", num(opts.MaxInFlight)},
+		{"Idempotent", strconv.FormatBool(opts.Idempotent)},
+		{"Payload", res.Payload},
+	}
+	if s.Duration > 0 {
+		settings = append(settings, setting{"Run time", time.Duration(s.Duration).String()})
+	} else {
+		settings = append(settings, setting{"Run time", fmt.Sprintf("%d messages per producer", s.Messages)})
+	}
+	settings = append(settings, setting{"Measurement window", windowText(res.Window)})
+	if len(res.Hosts) > 0 {
+		settings = append(settings, setting{"Hosts", strconv.Itoa(len(res.Hosts))})
+	}
+	for _, g := range s.Groups {
+		prefix := "Group " + g.Name + " "
+		if len(s.Groups) == 1 {
+			prefix = ""
+		}
+		keys := g.Keys
+		if keys == "none" {
+			keys = "no keys"
+		}
+		settings = append(settings,
+			setting{prefix + "Topics", strconv.Itoa(len(g.Topics))},
+			setting{prefix + "Producers per topic", strconv.Itoa(g.Producers)},
+			setting{prefix + "Consumers per topic", strconv.Itoa(g.Consumers)},
+			setting{prefix + "Rate (msg per sec per producer)", fmt.Sprintf("%d (%s schedule)", g.Rate, g.Schedule)},
+			setting{prefix + "Message size", g.Size},
+			setting{prefix + "Keys", keys})
+	}
+	return settings
+}
+
+// reportLabels labels columns by scenario name or driver if they tell
+// results apart, by settings that differ otherwise, and by file names
+// if nothing does.
+func reportLabels(names []string, results []Result, settings [][]setting, differ []int) []string {
+	distinct := func(label func(i int) string) []string {
+		labels := make([]string, len(results))
+		seen := make(map[string]bool)
+		for i := range results {
+			labels[i] = label(i)
+			if labels[i] == "" || seen[labels[i]] {
+				return nil
+			}
+			seen[labels[i]] = true
+		}
+		return labels
+	}
+	if labels := distinct(func(i int) string { return results[i].Scenario.Name }); labels != nil {
+		return labels
+	}
+	if labels := distinct(func(i int) string { return results[i].Scenario.Driver }); labels != nil {
+		return labels
+	}
+	if labels := distinct(func(i int) string {
+		var parts []string
+		for _, j := range differ {
+			if j < len(settings[i]) {
+				parts = append(parts, settings[i][j].name+" "+settings[i][j].value)
+			}
+		}
+		return strings.Join(parts, ", ")
+	}); labels != nil {
+		return labels
+	}
+	return names
+}
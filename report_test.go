@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// reportResult returns result of a scenario run on driver, throughput and
+// latency percentiles in ms.
+func reportResult(t *testing.T, driver string, throughput float64, p Percentiles) Result {
+	t.Helper()
+	s := &Scenario{
+		Driver:   driver,
+		Brokers:  []string{"b1:9092", "b2:9092", "b3:9092"},
+		Duration: duration(5 * time.Minute),
+		Groups:   []TopicGroup{{Topics: []string{"t0"}, Rate: 1000, Size: "fixed:1024"}},
+	}
+	if err := s.resolve(); err != nil {
+		t.Fatal(err)
+	}
+	return Result{Scenario: s, Payload: "fill", Throughput: throughput, DataThroughput: throughput / 1024,
+		Percentiles: LatencyPercentiles{Latency: p}}
+}
+
+func TestPrintReport(t *testing.T) {
+	results := []Result{
+		reportResult(t, "kafka", 1019.314, Percentiles{Count: 1000, Min: 0.2, P90: 1.4, P99: 1.9, P999: 7.6, Max: 8.1}),
+		reportResult(t, "redpanda", 1371, Percentiles{Count: 1000, Min: 0.3, P90: 1, P99: 1.2, P999: 2.5, Max: 20.7}),
+	}
+	var b strings.Builder
+	printReport(&b, "Single topic", []string{"a", "b"}, results, false)
+	out := b.String()
+
+	for _, want := range []string{
+		"## Single topic\n\nSetup is:\n",
+		"* Brokers: 3\n",
+		"* Run time: 5m0s\n",
+		"* Message size: fixed:1024\n",
+		"|  | kafka | redpanda |\n| --- | --- | --- |\n",
+		"| Driver | kafka | redpanda |\n",
+		"| Message throughput (msg per sec) | 1019.31 | 1371.00 |\n",
+		"| Data throughput (Mb per sec) | 0.995424 | 1.338867 |\n",
+		// Latency is in whole milliseconds, like the text summary.
+		"| Min latency (ms) | 0 | 0 |\n",
+		"| P90 latency (ms) | 1 | 1 |\n",
+		"| P99.9 latency (ms) | 7 | 2 |\n",
+		"| Max latency (ms) | 8 | 20 |\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report has no %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "* Driver:") {
+		t.Errorf("setting that differs is in the common setup:\n%s", out)
+	}
+
+	// Explicit labels, no latency measured.
+	results[1].Percentiles.Latency = Percentiles{}
+	b.Reset()
+	printReport(&b, "", []string{"before", "after"}, results, true)
+	out = b.String()
+	if strings.HasPrefix(out, "##") || !strings.Contains(out, "|  | before | after |\n") || !strings.Contains(out, "| Max latency (ms) | 8 | - |\n") {
+		t.Errorf("report with explicit labels:\n%s", out)
+	}
+}
+
+func TestReportLabels(t *testing.T) {
+	a, b := reportResult(t, "kafka", 1, Percentiles{}), reportResult(t, "kafka", 1, Percentiles{})
+	zstd := "zstd"
+	b.Scenario.Options.Compression = &zstd
+	settings := [][]setting{reportSettings(a), reportSettings(b)}
+	var differ []int
+	for j := range settings[0] {
+		if settings[0][j] != settings[1][j] {
+			differ = append(differ, j)
+		}
+	}
+	names := []string{"a.result", "b.result"}
+	if got := reportLabels(names, []Result{a, b}, settings, differ); got[0] != "Compression snappy" || got[1] != "Compression zstd" {
+		t.Errorf("labels %q, want the setting that differs", got)
+	}
+	if got := reportLabels(names, []Result{a, a}, [][]setting{settings[0], settings[0]}, nil); got[0] != "a.result" {
+		t.Errorf("labels %q of the same scenarios, want file names", got)
+	}
+	a.Scenario.Name, b.Scenario.Name = "baseline", "compressed"
+	if got := reportLabels(names, []Result{a, b}, settings, differ); got[0] != "baseline" || got[1] != "compressed" {
+		t.Errorf("labels %q, want scenario names", got)
+	}
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"time"
+
+	"gonum.org/v1/gonum/stat"
+)
+
+// resultSchema is the version of Result document layout,
+// bump it when fields are removed or change meaning.
+const resultSchema = 1
+
+// Result is the result document of a benchmark run. It is written as JSON
+// for further processing, text report is rendered from it too.
+type Result struct {
+	Schema      int         `json:"schema"`
+	RunID       string      `json:"run_id"`
+	Role        string      `json:"role"`     // What this process did: produce, consume or both.
+	Scenario    *Scenario   `json:"scenario"` // Resolved scenario that was run.
+	Environment Environment `json:"environment"`
+	Clock       *ClockSync  `json:"clock,omitempty"` // Only for runs of a coordinator.
+	Start       time.Time   `json:"start"`
+	End         time.Time   `json:"end"`
+	Elapsed     duration    `json:"elapsed"`
+	Payload     string      `json:"payload"` // Payload generator description.
+
+	Produced          int64   `json:"produced"` // Acknowledged messages.
+	Consumed          int64   `json:"consumed"`
+	ConsumedBytes     int64   `json:"consumed_bytes"`
+	ProduceThroughput float64 `json:"produce_throughput"` // Acknowledged messages per second.
+	Throughput        float64 `json:"throughput"`         // Consumed messages per second.
+	DataThroughput    float64 `json:"data_throughput"`    // Consumed MiB per second.
+	// ApproxThroughput is set for merged results of concurrent hosts that
+	// have no time series: throughput is the sum of host rates then, rather
+	// than what was counted in the common time window.
+	ApproxThroughput bool `json:"approx_throughput,omitempty"`
+	// MeasuredThroughput is throughput of the measurement window with
+	// confidence interval, known when time series has enough intervals.
+	MeasuredThroughput *ThroughputEstimate `json:"measured_throughput,omitempty"`
+
+	Window      MeasureWindow      `json:"window"` // Messages latency is measured for.
+	Percentiles LatencyPercentiles `json:"percentiles"`
+	Latencies   *producerLatencies `json:"latencies"`       // All producers merged.
+	Sizes       []SizeSummary      `json:"sizes,omitempty"` // Latency per message size bucket.
+	// Series is not kept by merge, intervals of different hosts don't line up.
+	Series *Series `json:"series,omitempty"`
+
+	Errors    ErrorCounts `json:"errors"`
+	Drained   bool        `json:"drained"`    // All topics drained before timeout.
+	DrainTime duration    `json:"drain_time"` // The longest topic drain.
+
+	Topics []TopicSummary `json:"topics"`
+	Hosts  []HostSummary  `json:"hosts,omitempty"` // Results merged into this one.
+
+	Assertions []AssertionResult `json:"assertions,omitempty"` // Scenario and baseline checks.
+}
+
+// Environment describes the host that ran the benchmark.
+type Environment struct {
+	Hostname  string   `json:"hostname"`
+	OS        string   `json:"os"`
+	Arch      string   `json:"arch"`
+	CPUs      int      `json:"cpus"`
+	GoVersion string   `json:"go_version"`
+	Args      []string `json:"args"` // Command line arguments.
+}
+
+// MeasureWindow tells which messages latency is measured for,
+// by their intended send time.
+type MeasureWindow struct {
+	Mode     string       `json:"mode"`     // legacy (first and last 10% excluded), fixed or steady.
+	Warmup   duration     `json:"warmup"`   // Excluded at the start.
+	Cooldown duration     `json:"cooldown"` // Excluded at the end of production.
+	Steady   *SteadyState `json:"steady,omitempty"`
+	// SteadyAt is when steady state was detected since the run start, measurement
+	// starts there. Zero if it was not reached and nothing was measured.
+	SteadyAt duration `json:"steady_at,omitempty"`
+}
+
+// Percentiles summarize a latency histogram, all values are in milliseconds.
+type Percentiles struct {
+	Count  int64   `json:"count"`
+	Min    float64 `json:"min"`
+	P50    float64 `json:"p50"`
+	P90    float64 `json:"p90"`
+	P99    float64 `json:"p99"`
+	P999   float64 `json:"p99_9"`
+	Max    float64 `json:"max"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stddev"`
+	StdErr float64 `json:"stderr"`
+	// CI are percentile confidence intervals, left out of time series intervals.
+	CI *PercentileCI `json:"ci,omitempty"`
+}
+
+// LatencyPercentiles are Percentiles of every producerLatencies histogram.
+type LatencyPercentiles struct {
+	Latency   Percentiles `json:"latency"`
+	Corrected Percentiles `json:"corrected"`
+	Ack       Percentiles `json:"ack"`
+	Append    Percentiles `json:"append"`
+	Delivery  Percentiles `json:"delivery"`
+}
+
+// ErrorCounts are errors of all topics.
+type ErrorCounts struct {
+	ProduceFailed uint64 `json:"produce_failed"` // Produce calls that returned an error.
+	Missing       uint64 `json:"missing"`        // Acknowledged messages never consumed.
+	HeadMissing   uint64 `json:"head_missing"`   // Missing sent before a stream was first seen.
+	Duplicated    uint64 `json:"duplicated"`
+	Gaps          uint64 `json:"gaps"`      // Times a producer stream skipped ahead.
+	Reordered     uint64 `json:"reordered"` // Late deliveries filling a gap.
+	DrainTimeouts int    `json:"drain_timeouts"`
+}
+
+// SizeSummary is latency of messages of one size bucket.
+type SizeSummary struct {
+	Bucket    string      `json:"bucket"`
+	MaxSize   int         `json:"max_size"` // The largest message size of the bucket.
+	Latency   Percentiles `json:"latency"`
+	Histogram *Histogram  `json:"histogram"` // Kept for exact merges.
+}
+
+// TopicSummary is what was measured for a single topic.
+type TopicSummary struct {
+	topicAudit
+	Group          string             `json:"group"`
+	Elapsed        duration           `json:"elapsed"` // From the start to the end of drain.
+	ConsumedBytes  uint64             `json:"consumed_bytes"`
+	Throughput     float64            `json:"throughput"`      // Consumed messages per second.
+	DataThroughput float64            `json:"data_throughput"` // Consumed MiB per second.
+	TimestampType  string             `json:"timestamp_type"`  // Type of broker timestamps seen by consumers.
+	Percentiles    LatencyPercentiles `json:"percentiles"`
+	Fairness       *Fairness          `json:"fairness,omitempty"` // Only for topics with several producers.
+	Partitions     []PartitionSummary `json:"partitions,omitempty"`
+	Producers      []ProducerSummary  `json:"producers"`
+}
+
+// Fairness tells whether producers sharing a topic got equal service,
+// it compares their delivered throughput (acknowledged one if nothing was
+// consumed): with rate limited producers acknowledged throughput is the
+// same by construction and hides consumers starving some of them.
+type Fairness struct {
+	// Jain is Jain's fairness index: 1 when all producers have the same
+	// throughput down to 1/n when a single one gets all of it.
+	Jain float64 `json:"jain"`
+	Min  float64 `json:"min"` // The lowest producer throughput.
+	Max  float64 `json:"max"` // The highest producer throughput.
+	// Spread is the difference between the highest and the lowest
+	// throughput relative to the mean.
+	Spread float64 `json:"spread"`
+}
+
+// PartitionSummary is what was consumed from a single partition.
+type PartitionSummary struct {
+	Partition int32       `json:"partition"`
+	Received  uint64      `json:"received"`
+	Latency   Percentiles `json:"latency"`
+	Histogram *Histogram  `json:"histogram"` // Kept for exact merges.
+}
+
+// ProducerSummary is what was measured for a single producer stream.
+type ProducerSummary struct {
+	RunID       string `json:"run_id"` // Run id of the producing process.
+	ID          uint32 `json:"id"`
+	Produced    uint64 `json:"produced"`
+	Acked       uint64 `json:"acked"`
+	Failed      uint64 `json:"failed"`
+	Received    uint64 `json:"received"`
+	Missing     uint64 `json:"missing"`
+	HeadMissing uint64 `json:"head_missing"` // Missing sent before the stream was first seen.
+	Gaps        uint64 `json:"gaps"`
+	Duplicates  uint64 `json:"duplicates"`
+	Reordered   uint64 `json:"reordered"`
+	// Producer side counts and throughput are only known for
+	// streams that ended (see Envelope).
+	Elapsed    duration `json:"elapsed"`    // Time spent producing.
+	Throughput float64  `json:"throughput"` // Acknowledged messages per second of producing.
+	Delivered  float64  `json:"delivered"`  // Consumed messages per second of producing.
+	Lag        duration `json:"lag"`        // How far behind schedule the last message was sent.
+	MaxLag     duration `json:"max_lag"`    // The worst schedule lag.
+
+	Percentiles LatencyPercentiles `json:"percentiles"`
+	// Latencies are kept so that producers of several hosts or runs can be merged exactly.
+	Latencies *producerLatencies `json:"latencies"`
+}
+
+// HostSummary is a result document merged into another one.
+type HostSummary struct {
+	Name              string             `json:"name"` // Result file name.
+	Hostname          string             `json:"hostname"`
+	RunID             string             `json:"run_id"`
+	Role              string             `json:"role"`
+	Clock             *ClockSync         `json:"clock,omitempty"`
+	Start             time.Time          `json:"start"`
+	End               time.Time          `json:"end"`
+	Elapsed           duration           `json:"elapsed"`
+	Produced          int64              `json:"produced"`
+	Consumed          int64              `json:"consumed"`
+	ProduceThroughput float64            `json:"produce_throughput"`
+	Throughput        float64            `json:"throughput"`
+	DataThroughput    float64            `json:"data_throughput"`
+	Percentiles       LatencyPercentiles `json:"percentiles"`
+	Errors            ErrorCounts        `json:"errors"`
+}
+
+func newPercentiles(h *Histogram) Percentiles {
+	if h.Count() == 0 {
+		return Percentiles{}
+	}
+	stddev := h.StdDev()
+	return Percentiles{
+		Count:  h.Count(),
+		Min:    toMs(h.Min()),
+		P50:    toMs(h.Quantile(0.5)),
+		P90:    toMs(h.Quantile(0.9)),
+		P99:    toMs(h.Quantile(0.99)),
+		P999:   toMs(h.Quantile(0.999)),
+		Max:    toMs(h.Max()),
+		Mean:   toMs(h.Mean()),
+		StdDev: stddev,
+		StdErr: stat.StdErr(stddev, float64(h.Count())),
+	}
+}
+
+// newPercentilesCI summarizes h with confidence intervals.
+func newPercentilesCI(h *Histogram) Percentiles {
+	p := newPercentiles(h)
+	if p.Count > 0 {
+		p.CI = newPercentileCI(h)
+	}
+	return p
+}
+
+func newLatencyPercentiles(l *producerLatencies) LatencyPercentiles {
+	return LatencyPercentiles{
+		Latency:   newPercentilesCI(l.Latency),
+		Corrected: newPercentilesCI(l.Corrected),
+		Ack:       newPercentilesCI(l.Ack),
+		Append:    newPercentilesCI(l.Append),
+		Delivery:  newPercentilesCI(l.Delivery),
+	}
+}
+
+func toMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func newEnvironment() Environment {
+	hostname, _ := os.Hostname()
+	return Environment{
+		Hostname:  hostname,
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		CPUs:      runtime.NumCPU(),
+		GoVersion: runtime.Version(),
+		Args:      os.Args[1:],
+	}
+}
+
+// newTopicSummary summarizes topic results, ordered by partition and producer id.
+func newTopicSummary(res topicResult, precision int) (TopicSummary, error) {
+	t := TopicSummary{
+		topicAudit:     res.audit,
+		Group:          res.group,
+		Elapsed:        duration(res.elapsed),
+		ConsumedBytes:  res.bytes,
+		Throughput:     float64(res.audit.Consumed) / res.elapsed.Seconds(),
+		DataThroughput: float64(res.bytes) / res.elapsed.Seconds() / 1024 / 1024,
+		TimestampType:  res.tsType.String(),
+	}
+
+	for id, ps := range res.partitions {
+		t.Partitions = append(t.Partitions, PartitionSummary{Partition: id, Received: ps.Received, Latency: newPercentilesCI(ps.Latency), Histogram: ps.Latency})
+	}
+	sort.Slice(t.Partitions, func(i, j int) bool { return t.Partitions[i].Partition < t.Partitions[j].Partition })
+
+	latencies := newProducerLatencies(precision)
+	for _, s := range res.streams {
+		c := s.Counts
+		p := ProducerSummary{
+			RunID:       fmt.Sprintf("%016x", s.RunID),
+			ID:          s.ProducerID,
+			Produced:    c.Produced,
+			Acked:       c.Acked,
+			Failed:      uint64(len(c.failed)),
+			Received:    s.Received,
+			Missing:     s.Missing(),
+			HeadMissing: s.HeadMissing(),
+			Gaps:        s.Gaps,
+			Duplicates:  s.Duplicates,
+			Reordered:   s.Reordered,
+			Elapsed:     duration(c.Elapsed),
+			Lag:         duration(c.Lag),
+			MaxLag:      duration(c.MaxLag),
+			Latencies:   res.histograms[s.streamID],
+		}
+		if p.Latencies == nil {
+			p.Latencies = newProducerLatencies(precision)
+		}
+		if c.Elapsed > 0 {
+			p.Throughput = float64(c.Acked) / c.Elapsed.Seconds()
+			p.Delivered = float64(s.Received) / c.Elapsed.Seconds()
+		}
+		p.Percentiles = newLatencyPercentiles(p.Latencies)
+		if err := latencies.merge(p.Latencies); err != nil {
+			return t, err
+		}
+		t.Producers = append(t.Producers, p)
+	}
+	t.Percentiles = newLatencyPercentiles(latencies)
+	t.Fairness = producersFairness(t.Producers)
+
+	return t, nil
+}
+
+// addTopic adds topic counts and errors to result totals.
+func (r *Result) addTopic(t TopicSummary) {
+	r.Topics = append(r.Topics, t)
+	r.Produced += int64(t.Acked)
+	r.Consumed += int64(t.Consumed)
+	r.ConsumedBytes += int64(t.ConsumedBytes)
+	r.Errors.Missing += t.Missing
+	r.Errors.HeadMissing += t.HeadMissing
+	r.Errors.Duplicated += t.Duplicated
+	for _, p := range t.Producers {
+		r.Errors.ProduceFailed += p.Failed
+		r.Errors.Gaps += p.Gaps
+		r.Errors.Reordered += p.Reordered
+	}
+	if !t.Drained {
+		r.Errors.DrainTimeouts++
+		r.Drained = false
+	}
+	if t.DrainTime > r.DrainTime {
+		r.DrainTime = t.DrainTime
+	}
+}
+
+// producersFairness compares producers with known throughput,
+// nil unless there are several of them.
+func producersFairness(producers []ProducerSummary) *Fairness {
+	var acked, delivered []float64
+	consumed := false
+	for _, p := range producers {
+		if p.Elapsed > 0 {
+			acked = append(acked, p.Throughput)
+			delivered = append(delivered, p.Delivered)
+			consumed = consumed || p.Received > 0
+		}
+	}
+	switch {
+	case len(acked) < 2:
+		return nil
+	case consumed:
+		return newFairness(delivered)
+	}
+	return newFairness(acked)
+}
+
+func newFairness(throughput []float64) *Fairness {
+	f := &Fairness{Min: throughput[0], Max: throughput[0]}
+	var sum, sumSq float64
+	for _, x := range throughput {
+		sum += x
+		sumSq += x * x
+		f.Min = math.Min(f.Min, x)
+		f.Max = math.Max(f.Max, x)
+	}
+	if sumSq > 0 {
+		n := float64(len(throughput))
+		f.Jain = sum * sum / (n * sumSq)
+		f.Spread = (f.Max - f.Min) / (sum / n)
+	}
+
+	return f
+}
+
+// writeResult writes result document as JSON.
+func writeResult(path string, res Result) error {
+	b, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
@@ -34,7 +34,17 @@ then
 
     for ip in ${IPS[@]}
     do
-        scp -i pk.pk ./bench ./run.sh ubuntu@$ip:
+        scp -i pk.pk ./bench ./run.sh tests/*.json ubuntu@$ip:
+    done
+    exit 0
+fi
+
+if [ "$1" == "agents" ]
+then
+    . tests/5producers
+    for ip in ${IPS[@]}
+    do
+        ssh -i pk.pk ubuntu@$ip ./run.sh agent
     done
     exit 0
 fi
@@ -45,31 +55,22 @@ TEST_NAME="${1:-5producers}"
 . tests/$TEST_NAME
 
 echo "Running $TEST_NAME"
+mkdir -p $TEST_NAME
 
-# Start benchmarks on all instances.
-for ((i=0;i<${#IPS[@]};i++))
-do
-    echo "Starting ./run.sh ${TOPICS[$i]} at ${IPS[$i]}"
-    ssh -i pk.pk ubuntu@${IPS[$i]} ./run.sh \"$PARAMS -topics=${TOPICS[$i]}\"
-done
-
-# 5 min to run all benchmarks.
-sleep 315
-
-mkdir $TEST_NAME
-pushd $TEST_NAME
-
-# truncate files
->latencies.csv
->stdout.txt
-for ip in ${IPS[@]}
-do
-    echo "copying latencies.csv from $ip"
-    ssh -i ../pk.pk ubuntu@$ip cat latencies.csv >> latencies.csv
-    echo "copying bench.out from $ip"
-    ssh -i ../pk.pk ubuntu@$ip cat bench.out >> stdout.txt
-done
+# Every agent runs the scenario on its own topics.
+{
+    echo "{\"scenario\": \"../$SCENARIO\", \"agents\": ["
+    for ((i=0;i<${#IPS[@]};i++))
+    do
+        [ $i -gt 0 ] && echo ","
+        echo "{\"name\": \"${IPS[$i]}\", \"url\": \"http://${IPS[$i]}:7070\", \"topics\": [\"${TOPICS[$i]//,/\", \"}\"]}"
+    done
+    echo "]}"
+} > $TEST_NAME/cluster.json
 
-cat stdout.txt
+# Agents must be running (./runall.sh agents), the run fails if any of them fails.
+go run . coordinate -out $TEST_NAME $TEST_NAME/cluster.json | tee $TEST_NAME/stdout.txt
+[ ${PIPESTATUS[0]} -eq 0 ] || exit 1
 
-popd
+# Exact global report from histograms and counters of all agents.
+go run . merge -out $TEST_NAME/merged.json $TEST_NAME/*.result.json | tee $TEST_NAME/merged.txt
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"streambench/brokers"
+)
+
+// Scenario is a declarative benchmark run definition, see tests/*.json.
+// Resolved scenario has all defaults filled in and is embedded into results,
+// so every result tells exactly what was run.
+type Scenario struct {
+	Name     string          `json:"name,omitempty"`
+	Driver   string          `json:"driver"`
+	Brokers  []string        `json:"brokers"`
+	Options  scenarioOptions `json:"options"`
+	Duration duration        `json:"duration,omitempty"` // Production time limit.
+	Messages int             `json:"messages,omitempty"` // Number of messages per producer.
+	// Warmup and Cooldown are excluded from latency measurement at the start
+	// and at the end of production, if none of them nor SteadyState is set
+	// first and last 10% of the run are excluded instead.
+	Warmup   *duration `json:"warmup,omitempty"`
+	Cooldown duration  `json:"cooldown,omitempty"`
+	// SteadyState starts measurement once throughput and latency are stable (after warmup).
+	SteadyState *SteadyState `json:"steady_state,omitempty"`
+	Drain       duration     `json:"drain"` // Max time to wait for in-flight messages after producers stop.
+	// Interval of throughput and latency time series, 1s by default.
+	Interval duration      `json:"interval"`
+	Payload  PayloadConfig `json:"payload"`
+	Groups   []TopicGroup  `json:"groups"`
+	// Assertions are checked after the run, like "p99 < 15ms" (see assertion),
+	// a failed one makes the run exit with non-zero status.
+	Assertions []string `json:"assertions,omitempty"`
+}
+
+// TopicGroup is a set of topics sharing the same workload.
+type TopicGroup struct {
+	Name      string   `json:"name"`
+	Topics    []string `json:"topics"`
+	Rate      int      `json:"rate"`      // Messages per second per producer.
+	Schedule  string   `json:"schedule"`  // Producer scheduling mode (closed, constant or poisson).
+	Size      string   `json:"size"`      // Message size distribution spec.
+	Keys      string   `json:"keys"`      // Message key distribution spec.
+	Producers int      `json:"producers"` // Producers per topic.
+	Consumers int      `json:"consumers"` // Consumers per topic.
+}
+
+// SteadyState is a moving window stability test: the run is steady once
+// throughput and P50 latency of every interval in the window are within
+// tolerance, as coefficient of variation.
+type SteadyState struct {
+	Window    duration `json:"window"`    // 10s by default.
+	Tolerance float64  `json:"tolerance"` // 0.1 by default.
+}
+
+// scenarioOptions are driver options, unset ones take driver defaults.
+type scenarioOptions struct {
+	Acks        *string   `json:"acks,omitempty"`
+	Compression *string   `json:"compression,omitempty"`
+	Linger      *duration `json:"linger,omitempty"`
+	BatchSize   *int      `json:"batch_size,omitempty"`
+	BatchBytes  *int      `json:"batch_bytes,omitempty"`
+	MaxInFlight *int      `json:"max_in_flight,omitempty"`
+	Idempotent  *bool     `json:"idempotent,omitempty"`
+}
+
+// duration is time.Duration written as a string ("1m30s") in JSON.
+type duration time.Duration
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"90s\" or \"5m\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// loadScenario reads scenario file, unknown fields are rejected.
+func loadScenario(path string) (Scenario, error) {
+	var s Scenario
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return s, fmt.Errorf("failed to read scenario: %w", err)
+	}
+
+	return s, decodeStrict(path, b, &s)
+}
+
+// decodeStrict decodes JSON document rejecting unknown fields,
+// errors point to the position in the document.
+func decodeStrict(path string, b []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			return fmt.Errorf("%s:%s: %w", path, position(b, syntaxErr.Offset), err)
+		case errors.As(err, &typeErr):
+			return fmt.Errorf("%s:%s: %s must be %v", path, position(b, typeErr.Offset), typeErr.Field, typeErr.Type)
+		}
+		return fmt.Errorf("%s:%s: %w", path, position(b, dec.InputOffset()), err)
+	}
+
+	return nil
+}
+
+// position returns line:column of byte offset.
+func position(b []byte, offset int64) string {
+	if offset > int64(len(b)) {
+		offset = int64(len(b))
+	}
+	line := 1 + bytes.Count(b[:offset], []byte("\n"))
+	col := offset - int64(bytes.LastIndexByte(b[:offset], '\n'))
+	return fmt.Sprintf("%d:%d", line, col)
+}
+
+// resolve validates scenario and fills in defaults.
+func (s *Scenario) resolve() error {
+	switch s.Driver {
+	case "kafka", "redpanda", "nats", "pulsar":
+	case "":
+		return fmt.Errorf("driver: required (kafka, redpanda, nats or pulsar)")
+	default:
+		return fmt.Errorf("driver: unknown driver %q (want kafka, redpanda, nats or pulsar)", s.Driver)
+	}
+	if len(s.Brokers) == 0 {
+		return fmt.Errorf("brokers: at least one broker url required")
+	}
+	for i, b := range s.Brokers {
+		if b == "" {
+			return fmt.Errorf("brokers[%d]: empty broker url", i)
+		}
+	}
+
+	opts := s.Options.resolve(s.Driver)
+	if err := opts.Validate(s.Driver); err != nil {
+		return fmt.Errorf("options: %w", err)
+	}
+	s.Options = newScenarioOptions(opts)
+
+	if (s.Duration > 0) == (s.Messages > 0) {
+		return fmt.Errorf("duration, messages: set either production time limit or number of messages per producer, but not both")
+	}
+	if s.Duration < 0 || s.Messages < 0 {
+		return fmt.Errorf("duration, messages: can't be negative")
+	}
+	if s.Warmup != nil {
+		if *s.Warmup < 0 {
+			return fmt.Errorf("warmup: can't be negative, got %v", time.Duration(*s.Warmup))
+		}
+		if s.Duration > 0 && *s.Warmup >= s.Duration {
+			return fmt.Errorf("warmup: %v leaves nothing to measure in %v run", time.Duration(*s.Warmup), time.Duration(s.Duration))
+		}
+	}
+	if s.Drain == 0 {
+		s.Drain = duration(30 * time.Second)
+	}
+	if s.Drain < 0 {
+		return fmt.Errorf("drain: can't be negative, got %v", time.Duration(s.Drain))
+	}
+	if s.Interval == 0 {
+		s.Interval = duration(time.Second)
+	}
+	if s.Interval < 0 {
+		return fmt.Errorf("interval: can't be negative, got %v", time.Duration(s.Interval))
+	}
+	if s.Cooldown < 0 {
+		return fmt.Errorf("cooldown: can't be negative, got %v", time.Duration(s.Cooldown))
+	}
+	if s.Cooldown > 0 {
+		if s.Duration == 0 {
+			return fmt.Errorf("cooldown: needs production time limit (duration), the end of a run by number of messages is not known in advance")
+		}
+		warmup := duration(0)
+		if s.Warmup != nil {
+			warmup = *s.Warmup
+		}
+		if warmup+s.Cooldown >= s.Duration {
+			return fmt.Errorf("cooldown: %v warmup and %v cooldown leave nothing to measure in %v run",
+				time.Duration(warmup), time.Duration(s.Cooldown), time.Duration(s.Duration))
+		}
+	}
+	if st := s.SteadyState; st != nil {
+		if st.Window == 0 {
+			st.Window = duration(10 * time.Second)
+		}
+		if st.Tolerance == 0 {
+			st.Tolerance = 0.1
+		}
+		if st.Window < 3*s.Interval {
+			return fmt.Errorf("steady_state.window: %v must span at least 3 intervals of %v", time.Duration(st.Window), time.Duration(s.Interval))
+		}
+		if st.Tolerance < 0 {
+			return fmt.Errorf("steady_state.tolerance: can't be negative, got %v", st.Tolerance)
+		}
+	}
+
+	if err := s.Payload.resolve(); err != nil {
+		return fmt.Errorf("payload.%w", err)
+	}
+
+	if len(s.Groups) == 0 {
+		return fmt.Errorf("groups: at least one topic group required")
+	}
+	seen := make(map[string]string)
+	for i := range s.Groups {
+		g := &s.Groups[i]
+		if g.Name == "" {
+			g.Name = fmt.Sprintf("group%d", i)
+		}
+		if err := g.resolve(); err != nil {
+			return fmt.Errorf("groups[%d].%w", i, err)
+		}
+		for j, t := range g.Topics {
+			if other, ok := seen[t]; ok {
+				return fmt.Errorf("groups[%d].topics[%d]: topic %q is already used by group %s", i, j, t, other)
+			}
+			seen[t] = g.Name
+		}
+	}
+
+	for i, a := range s.Assertions {
+		if _, err := parseAssertion(a); err != nil {
+			return fmt.Errorf("assertions[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func (g *TopicGroup) resolve() error {
+	if len(g.Topics) == 0 {
+		return fmt.Errorf("topics: at least one topic required")
+	}
+	for i, t := range g.Topics {
+		if t == "" {
+			return fmt.Errorf("topics[%d]: empty topic name", i)
+		}
+	}
+	if g.Rate <= 0 {
+		return fmt.Errorf("rate: must be positive, got %d", g.Rate)
+	}
+	switch g.Schedule {
+	case "":
+		g.Schedule = scheduleClosed
+	case scheduleClosed, scheduleConstant, schedulePoisson:
+	default:
+		return fmt.Errorf("schedule: unknown schedule %q (want closed, constant or poisson)", g.Schedule)
+	}
+	if g.Size == "" {
+		return fmt.Errorf("size: message size distribution required (e.g. \"fixed:1024\")")
+	}
+	if _, err := parseSizeDist(g.Size); err != nil {
+		return fmt.Errorf("size: %w", err)
+	}
+	if g.Keys == "" {
+		g.Keys = "none"
+	}
+	if _, err := parseKeyDist(g.Keys); err != nil {
+		return fmt.Errorf("keys: %w", err)
+	}
+	if g.Producers == 0 {
+		g.Producers = 1
+	}
+	if g.Producers < 0 {
+		return fmt.Errorf("producers: can't be negative, got %d", g.Producers)
+	}
+	if g.Consumers == 0 {
+		g.Consumers = 1
+	}
+	if g.Consumers < 0 {
+		return fmt.Errorf("consumers: can't be negative, got %d", g.Consumers)
+	}
+
+	return nil
+}
+
+func (p *PayloadConfig) resolve() error {
+	if p.Kind == "" {
+		p.Kind = payloadFill
+	}
+	if p.Kind != payloadText {
+		p.Ratio = 0
+	}
+	switch p.Kind {
+	case payloadFill, payloadRandom, payloadJSON:
+	case payloadText:
+		if p.Ratio == 0 {
+			p.Ratio = 3
+		}
+		if p.Ratio < 1 {
+			return fmt.Errorf("ratio: target compression ratio must be at least 1, got %g", p.Ratio)
+		}
+	case payloadCorpus:
+		if p.Corpus == "" {
+			return fmt.Errorf("corpus: file required for corpus payload")
+		}
+	default:
+		return fmt.Errorf("kind: unknown payload generator %q (want fill, random, text, json or corpus)", p.Kind)
+	}
+	if p.Seed == 0 {
+		p.Seed = 1
+	}
+
+	return nil
+}
+
+// resolve returns driver defaults overridden by options that are set.
+func (o scenarioOptions) resolve(driver string) brokers.Options {
+	opts := brokers.DefaultOptions(driver)
+	if o.Acks != nil {
+		opts.Acks = *o.Acks
+	}
+	if o.Compression != nil {
+		opts.Compression = *o.Compression
+	}
+	if o.Linger != nil {
+		opts.Linger = time.Duration(*o.Linger)
+	}
+	if o.BatchSize != nil {
+		opts.BatchSize = *o.BatchSize
+	}
+	if o.BatchBytes != nil {
+		opts.BatchBytes = *o.BatchBytes
+	}
+	if o.MaxInFlight != nil {
+		opts.MaxInFlight = *o.MaxInFlight
+	}
+	if o.Idempotent != nil {
+		opts.Idempotent = *o.Idempotent
+	} else if opts.Acks != brokers.AcksAll {
+		opts.Idempotent = false // Driver default idempotence needs all acks.
+	}
+
+	return opts
+}
+
+func newScenarioOptions(o brokers.Options) scenarioOptions {
+	linger := duration(o.Linger)
+	return scenarioOptions{
+		Acks:        &o.Acks,
+		Compression: &o.Compression,
+		Linger:      &linger,
+		BatchSize:   &o.BatchSize,
+		BatchBytes:  &o.BatchBytes,
+		MaxInFlight: &o.MaxInFlight,
+		Idempotent:  &o.Idempotent,
+	}
+}
+
+// assertions returns parsed assertions of resolved scenario.
+func (s Scenario) assertions() []assertion {
+	asserts := make([]assertion, len(s.Assertions))
+	for i, text := range s.Assertions {
+		asserts[i], _ = parseAssertion(text) // Checked by resolve.
+	}
+	return asserts
+}
+
+// targetRate is messages per second all producers of the scenario are scheduled to send.
+func (s Scenario) targetRate() float64 {
+	rate := 0
+	for _, g := range s.Groups {
+		rate += g.Rate * g.Producers * len(g.Topics)
+	}
+	return float64(rate)
+}
+
+// config returns run configuration of resolved scenario.
+func (s Scenario) config() Config {
+	cfg := Config{
+		Role:     roleBoth,
+		Driver:   s.Driver,
+		Options:  s.Options.resolve(s.Driver),
+		Brokers:  strings.Join(s.Brokers, ","),
+		Payload:  s.Payload,
+		Groups:   s.Groups,
+		Messages: s.Messages,
+		Duration: time.Duration(s.Duration),
+		Warmup:   legacyWarmup,
+		Drain:    time.Duration(s.Drain),
+		Interval: time.Duration(s.Interval),
+		Scenario: &s,
+	}
+	if s.Warmup != nil || s.Cooldown > 0 || s.SteadyState != nil {
+		cfg.Warmup = 0
+	}
+	if s.Warmup != nil {
+		cfg.Warmup = time.Duration(*s.Warmup)
+	}
+	cfg.Cooldown = time.Duration(s.Cooldown)
+	cfg.Steady = s.SteadyState
+
+	return cfg
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScenarioFiles(t *testing.T) {
+	files, err := filepath.Glob("tests/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if strings.Count(filepath.Base(f), ".") > 1 { // Sweeps and searches.
+			continue
+		}
+		s, err := loadScenario(f)
+		if err != nil {
+			t.Errorf("%s: %v", f, err)
+			continue
+		}
+		if err := s.resolve(); err != nil {
+			t.Errorf("%s: %v", f, err)
+		}
+	}
+}
+
+func TestScenarioResolve(t *testing.T) {
+	s := Scenario{
+		Driver:   "kafka",
+		Brokers:  []string{"localhost:9092"},
+		Duration: duration(time.Minute),
+		Groups:   []TopicGroup{{Topics: []string{"t0", "t1"}, Rate: 100, Size: "fixed:1024"}},
+	}
+	if err := s.resolve(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Drain != duration(30*time.Second) || s.Interval != duration(time.Second) {
+		t.Errorf("drain %v, interval %v, want 30s and 1s defaults", s.Drain, s.Interval)
+	}
+	if s.Payload.Kind != payloadFill || s.Payload.Seed != 1 {
+		t.Errorf("payload %+v, want fill with seed 1", s.Payload)
+	}
+	g := s.Groups[0]
+	if g.Name != "group0" || g.Schedule != scheduleClosed || g.Keys != "none" || g.Producers != 1 || g.Consumers != 1 {
+		t.Errorf("group %+v, want defaults", g)
+	}
+	if s.Options.Acks == nil || s.Options.Compression == nil {
+		t.Errorf("options %+v, want driver defaults", s.Options)
+	}
+
+	cfg := s.config()
+	if cfg.Brokers != "localhost:9092" || cfg.Duration != time.Minute || cfg.Warmup != legacyWarmup || cfg.Scenario == nil {
+		t.Errorf("config %+v does not match the scenario", cfg)
+	}
+	if cfg.Cooldown != 0 || cfg.Steady != nil {
+		t.Errorf("cooldown %v, steady state %+v, want none", cfg.Cooldown, cfg.Steady)
+	}
+	if rate := s.targetRate(); rate != 200 {
+		t.Errorf("target rate %v, want 200", rate)
+	}
+}
+
+func TestScenarioValidation(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		change func(s *Scenario)
+		err    string // Prefix of the error, it points to the invalid field.
+	}{
+		{"no driver", func(s *Scenario) { s.Driver = "" }, "driver:"},
+		{"unknown driver", func(s *Scenario) { s.Driver = "kinesis" }, "driver:"},
+		{"no brokers", func(s *Scenario) { s.Brokers = nil }, "brokers:"},
+		{"empty broker", func(s *Scenario) { s.Brokers = []string{""} }, "brokers[0]:"},
+		{"unknown acks", func(s *Scenario) { acks := "most"; s.Options.Acks = &acks }, "options:"},
+		{"duration and messages", func(s *Scenario) { s.Messages = 10 }, "duration, messages:"},
+		{"no limit", func(s *Scenario) { s.Duration = 0 }, "duration, messages:"},
+		{"negative drain", func(s *Scenario) { s.Drain = -1 }, "drain:"},
+		{"warmup too long", func(s *Scenario) { w := s.Duration; s.Warmup = &w }, "warmup:"},
+		{"negative cooldown", func(s *Scenario) { s.Cooldown = -1 }, "cooldown:"},
+		{"cooldown of messages run", func(s *Scenario) { s.Duration, s.Messages, s.Cooldown = 0, 1000, duration(time.Second) }, "cooldown:"},
+		{"nothing to measure", func(s *Scenario) { w := s.Duration / 2; s.Warmup, s.Cooldown = &w, w }, "cooldown:"},
+		{"short steady window", func(s *Scenario) { s.SteadyState = &SteadyState{Window: duration(2 * time.Second)} }, "steady_state.window:"},
+		{"negative tolerance", func(s *Scenario) { s.SteadyState = &SteadyState{Tolerance: -0.1} }, "steady_state.tolerance:"},
+		{"unknown payload", func(s *Scenario) { s.Payload.Kind = "zeros" }, "payload.kind:"},
+		{"low compression ratio", func(s *Scenario) { s.Payload = PayloadConfig{Kind: payloadText, Ratio: 0.5} }, "payload.ratio:"},
+		{"no corpus", func(s *Scenario) { s.Payload.Kind = payloadCorpus }, "payload.corpus:"},
+		{"no groups", func(s *Scenario) { s.Groups = nil }, "groups:"},
+		{"no topics", func(s *Scenario) { s.Groups[0].Topics = nil }, "groups[0].topics:"},
+		{"no rate", func(s *Scenario) { s.Groups[0].Rate = 0 }, "groups[0].rate:"},
+		{"unknown schedule", func(s *Scenario) { s.Groups[0].Schedule = "bursty" }, "groups[0].schedule:"},
+		{"no size", func(s *Scenario) { s.Groups[0].Size = "" }, "groups[0].size:"},
+		{"invalid size", func(s *Scenario) { s.Groups[0].Size = "fixed:0" }, "groups[0].size:"},
+		{"invalid keys", func(s *Scenario) { s.Groups[0].Keys = "zipfian:10" }, "groups[0].keys:"},
+		{"negative producers", func(s *Scenario) { s.Groups[0].Producers = -1 }, "groups[0].producers:"},
+		{"negative consumers", func(s *Scenario) { s.Groups[0].Consumers = -1 }, "groups[0].consumers:"},
+		{"topic in two groups", func(s *Scenario) { s.Groups = append(s.Groups, s.Groups[0]) }, "groups[1].topics[0]:"},
+		{"invalid assertion", func(s *Scenario) { s.Assertions = []string{"p99 ~ 10ms"} }, "assertions[0]:"},
+	} {
+		s := Scenario{
+			Driver:   "kafka",
+			Brokers:  []string{"localhost:9092"},
+			Duration: duration(time.Minute),
+			Groups:   []TopicGroup{{Topics: []string{"t0"}, Rate: 100, Size: "fixed:1024"}},
+		}
+		tt.change(&s)
+		err := s.resolve()
+		if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+			t.Errorf("%s: got %v, want %s error", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestLoadScenarioErrors(t *testing.T) {
+	dir := t.TempDir()
+	for _, tt := range []struct {
+		name, doc, err string
+	}{
+		{"unknown field", "{\n  \"driver\": \"kafka\",\n  \"brokres\": []\n}", `unknown field "brokres"`},
+		{"type", "{\n  \"driver\": \"kafka\",\n  \"groups\": [{\"rate\": \"fast\"}]\n}", `.json:3:29: `},
+		{"syntax", "{\n  \"driver\": \"kafka\",,\n}", `.json:2:22: `},
+		{"duration", `{"duration": 60}`, `duration must be a string`},
+	} {
+		path := filepath.Join(dir, tt.name+".json")
+		if err := os.WriteFile(path, []byte(tt.doc), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := loadScenario(path)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got %v, want error containing %q", tt.name, err, tt.err)
+		}
+	}
+	if _, err := loadScenario(filepath.Join(dir, "none.json")); err == nil {
+		t.Errorf("missing file loaded")
+	}
+}
+
+func TestScenarioSteadyState(t *testing.T) {
+	s := Scenario{
+		Driver:      "kafka",
+		Brokers:     []string{"localhost:9092"},
+		Duration:    duration(time.Minute),
+		Cooldown:    duration(5 * time.Second),
+		SteadyState: &SteadyState{},
+		Groups:      []TopicGroup{{Topics: []string{"t0"}, Rate: 100, Size: "fixed:1024"}},
+	}
+	if err := s.resolve(); err != nil {
+		t.Fatal(err)
+	}
+	if st := s.SteadyState; st.Window != duration(10*time.Second) || st.Tolerance != 0.1 {
+		t.Errorf("steady state %+v, want 10s window and 0.1 tolerance defaults", st)
+	}
+	// Either of them replaces the legacy 10% warmup and cooldown.
+	cfg := s.config()
+	if cfg.Warmup != 0 || cfg.Cooldown != 5*time.Second || cfg.Steady != s.SteadyState {
+		t.Errorf("config warmup %v, cooldown %v, steady state %+v", cfg.Warmup, cfg.Cooldown, cfg.Steady)
+	}
+}
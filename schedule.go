@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Producer scheduling modes.
+const (
+	// scheduleClosed sends next message 1/rate after the previous one was sent,
+	// so a stalled Produce call delays all following messages (closed loop).
+	scheduleClosed = "closed"
+	// scheduleConstant sends messages at fixed intervals regardless of broker (open loop).
+	scheduleConstant = "constant"
+	// schedulePoisson sends messages with exponentially distributed intervals (open loop).
+	schedulePoisson = "poisson"
+)
+
+// arrivals generates intended send times of an open loop producer.
+// Latency is measured from the intended time, so time a message spent waiting
+// for a stalled producer is accounted for (coordinated omission correction).
+type arrivals interface {
+	next() time.Time
+}
+
+func newArrivals(schedule string, start time.Time, rate int, seed int64) (arrivals, error) {
+	switch schedule {
+	case scheduleConstant:
+		return &constantArrivals{t: start, interval: time.Second / time.Duration(rate)}, nil
+	case schedulePoisson:
+		return &poissonArrivals{t: start, rate: float64(rate), rnd: rand.New(rand.NewSource(seed))}, nil
+	}
+
+	return nil, fmt.Errorf("unknown open loop schedule %q", schedule)
+}
+
+type constantArrivals struct {
+	t        time.Time
+	interval time.Duration
+}
+
+func (a *constantArrivals) next() time.Time {
+	t := a.t
+	a.t = a.t.Add(a.interval)
+	return t
+}
+
+type poissonArrivals struct {
+	t    time.Time
+	rate float64
+	rnd  *rand.Rand
+}
+
+func (a *poissonArrivals) next() time.Time {
+	a.t = a.t.Add(time.Duration(a.rnd.ExpFloat64() / a.rate * float64(time.Second)))
+	return a.t
+}
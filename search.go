@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+// Search modes.
+const (
+	searchBinary = "binary" // Bisect rate between min and max.
+	searchStep   = "step"   // Raise rate by step from min until SLO breaks.
+)
+
+// Search looks for the highest per producer rate that still meets the SLO.
+// Rate is applied to producers of every topic group of the base scenario.
+type Search struct {
+	Scenario    string   `json:"scenario"` // Base scenario file, relative to the search file.
+	Mode        string   `json:"mode"`
+	MinRate     int      `json:"min_rate"`
+	MaxRate     int      `json:"max_rate"`
+	Step        int      `json:"step,omitempty"`         // Rate step (step mode) or resolution (binary mode).
+	Duration    duration `json:"duration"`               // Duration of each probe run.
+	Cooldown    duration `json:"cooldown,omitempty"`     // Pause between probes.
+	ResetTopics bool     `json:"reset_topics,omitempty"` // Recreate topics empty before each probe.
+	SLO         SLO      `json:"slo"`
+}
+
+// SLO is what a run must meet to count as sustainable.
+type SLO struct {
+	Percentile float64  `json:"percentile"` // Like 99 or 99.9.
+	Latency    duration `json:"latency"`    // Corrected latency percentile must stay below it.
+	// MaxDrain limits backlog left when producers stop, a broker falling
+	// behind the offered rate accumulates backlog and drains longer.
+	MaxDrain duration `json:"max_drain"`
+	// MinRateRatio is the lowest acceptable ratio of achieved to offered
+	// produce rate (producers can't keep up with the offered rate otherwise).
+	MinRateRatio float64 `json:"min_rate_ratio"`
+}
+
+// searchProbe is a single run of the search.
+type searchProbe struct {
+	Rate      int     // Per producer rate.
+	Offered   float64 // Total offered messages per second.
+	Achieved  float64 // Total produced messages per second.
+	Result    Result
+	Violation string // Why SLO is not met (empty if it is).
+}
+
+// runSearch implements "search" command.
+func runSearch(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	out := fs.String("out", "", "file to write latency vs throughput table to (stdout only if empty)")
+	precision := fs.Int("hist_precision", defaultPrecision, "latency histogram precision (significant decimal digits, 1-3), each histogram takes about 188KB at 3")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s search [flags] SEARCH_FILE\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *precision < 1 || *precision > maxPrecision {
+		log.Fatalf("-hist_precision must be in 1..%d range", maxPrecision)
+	}
+
+	search, base, err := loadSearch(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Invalid search: %v", err)
+	}
+
+	var probes []searchProbe
+	probe := func(rate int) (bool, error) {
+		if len(probes) > 0 && search.Cooldown > 0 {
+			log.Printf("Cooling down for %v", time.Duration(search.Cooldown))
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Duration(search.Cooldown)):
+			}
+		}
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+
+		cfg, err := search.config(base, rate)
+		if err != nil {
+			return false, err
+		}
+		cfg.Precision = *precision
+		p := searchProbe{Rate: rate}
+		for _, g := range cfg.Groups {
+			p.Offered += float64(rate * g.Producers * len(g.Topics))
+		}
+		log.Printf("Search probe %d: %d messages/sec per producer (%.0f messages/sec total)", len(probes)+1, rate, p.Offered)
+		if search.ResetTopics {
+			if err := resetTopics(ctx, cfg); err != nil {
+				return false, fmt.Errorf("failed to reset topics: %w", err)
+			}
+		}
+		p.Result, err = RunBench(ctx, cfg)
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		if err != nil {
+			return false, err
+		}
+		p.Achieved = float64(p.Result.Produced) / cfg.Duration.Seconds()
+		p.Violation = search.SLO.check(p)
+		if p.Violation != "" {
+			log.Printf("Rate %d breaks SLO: %s", rate, p.Violation)
+		}
+		probes = append(probes, p)
+		return p.Violation == "", nil
+	}
+
+	best, err := search.run(probe)
+	if err != nil {
+		log.Printf("Search stopped: %v", err)
+	}
+
+	var table bytes.Buffer
+	writeSearchTable(&table, search.SLO, probes)
+	if best > 0 {
+		for _, p := range probes {
+			if p.Rate == best {
+				fmt.Fprintf(&table, "\nMax sustainable rate: %d messages/sec per producer (%.0f messages/sec total)\n", best, p.Offered)
+				break
+			}
+		}
+	} else {
+		fmt.Fprintf(&table, "\nNo probed rate meets the SLO\n")
+	}
+	fmt.Print(table.String())
+	if *out != "" {
+		if err := os.WriteFile(*out, table.Bytes(), 0o644); err != nil {
+			log.Fatalf("failed to write search table: %v", err)
+		}
+	}
+}
+
+func loadSearch(path string) (Search, Scenario, error) {
+	var search Search
+	var base Scenario
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return search, base, fmt.Errorf("failed to read search: %w", err)
+	}
+	if err := decodeStrict(path, b, &search); err != nil {
+		return search, base, err
+	}
+
+	if search.Scenario == "" {
+		return search, base, fmt.Errorf("scenario: base scenario file required")
+	}
+	search.Scenario = relativeTo(path, search.Scenario)
+	if base, err = loadScenario(search.Scenario); err != nil {
+		return search, base, err
+	}
+	switch search.Mode {
+	case "":
+		search.Mode = searchBinary
+	case searchBinary, searchStep:
+	default:
+		return search, base, fmt.Errorf("mode: unknown search mode %q (want binary or step)", search.Mode)
+	}
+	if search.MinRate <= 0 || search.MaxRate <= search.MinRate {
+		return search, base, fmt.Errorf("min_rate, max_rate: want 0 < min_rate < max_rate, got %d and %d", search.MinRate, search.MaxRate)
+	}
+	if search.Step < 0 {
+		return search, base, fmt.Errorf("step: can't be negative")
+	}
+	if search.Step == 0 {
+		if search.Mode == searchStep {
+			return search, base, fmt.Errorf("step: required in step mode")
+		}
+		// Bisect down to 1% of the range.
+		search.Step = (search.MaxRate-search.MinRate)/100 + 1
+	}
+	if search.Duration <= 0 {
+		return search, base, fmt.Errorf("duration: probe run duration required")
+	}
+	if search.Cooldown < 0 {
+		return search, base, fmt.Errorf("cooldown: can't be negative")
+	}
+	if err := search.SLO.validate(); err != nil {
+		return search, base, fmt.Errorf("slo.%w", err)
+	}
+	// Catch invalid scenario before the first probe.
+	if _, err := search.config(base, search.MinRate); err != nil {
+		return search, base, err
+	}
+
+	return search, base, nil
+}
+
+// config returns configuration of a probe run.
+func (s Search) config(base Scenario, rate int) (Config, error) {
+	base.Duration = s.Duration
+	base.Messages = 0
+	base.Groups = append([]TopicGroup(nil), base.Groups...)
+	for i := range base.Groups {
+		base.Groups[i].Rate = rate
+	}
+	if err := base.resolve(); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", s.Scenario, err)
+	}
+
+	return base.config(), nil
+}
+
+// run probes rates and returns the highest one meeting SLO (0 if none does).
+func (s Search) run(probe func(rate int) (bool, error)) (int, error) {
+	best := 0
+	if s.Mode == searchStep {
+		for rate := s.MinRate; rate <= s.MaxRate; rate += s.Step {
+			ok, err := probe(rate)
+			if err != nil || !ok {
+				return best, err
+			}
+			best = rate
+		}
+		return best, nil
+	}
+
+	lo, hi := s.MinRate, s.MaxRate
+	if ok, err := probe(lo); err != nil || !ok {
+		return best, err
+	}
+	best = lo
+	if ok, err := probe(hi); err != nil || ok {
+		if ok {
+			best = hi
+		}
+		return best, err
+	}
+	for hi-lo > s.Step {
+		mid := lo + (hi-lo)/2
+		ok, err := probe(mid)
+		if err != nil {
+			return best, err
+		}
+		if ok {
+			lo, best = mid, mid
+		} else {
+			hi = mid
+		}
+	}
+
+	return best, nil
+}
+
+func (slo *SLO) validate() error {
+	if slo.Percentile <= 0 || slo.Percentile >= 100 {
+		return fmt.Errorf("percentile: must be in (0, 100) range, got %g", slo.Percentile)
+	}
+	if slo.Latency <= 0 {
+		return fmt.Errorf("latency: latency bound required")
+	}
+	if slo.MaxDrain < 0 {
+		return fmt.Errorf("max_drain: can't be negative")
+	}
+	if slo.MaxDrain == 0 {
+		slo.MaxDrain = duration(time.Second)
+	}
+	if slo.MinRateRatio < 0 || slo.MinRateRatio > 1 {
+		return fmt.Errorf("min_rate_ratio: must be in [0, 1] range, got %g", slo.MinRateRatio)
+	}
+	if slo.MinRateRatio == 0 {
+		slo.MinRateRatio = 0.95
+	}
+
+	return nil
+}
+
+// check returns SLO violation description, or empty string if probe meets SLO.
+func (slo SLO) check(p searchProbe) string {
+	res := p.Result
+	switch {
+	case res.Consumed == 0:
+		return "no messages consumed"
+	case res.Errors.Missing > 0:
+		return fmt.Sprintf("%d messages missing", res.Errors.Missing)
+	case !res.Drained:
+		return "backlog not drained before timeout"
+	case res.DrainTime > slo.MaxDrain:
+		return fmt.Sprintf("backlog took %v to drain", time.Duration(res.DrainTime).Round(time.Millisecond))
+	case p.Achieved < p.Offered*slo.MinRateRatio:
+		return fmt.Sprintf("produced %.0f of %.0f offered messages/sec", p.Achieved, p.Offered)
+	}
+	if l := res.Latencies.Corrected.Quantile(slo.Percentile / 100); l >= time.Duration(slo.Latency) {
+		return fmt.Sprintf("P%g latency %v", slo.Percentile, l)
+	}
+
+	return ""
+}
+
+// writeSearchTable writes measured latency vs throughput curve as markdown table.
+func writeSearchTable(w io.Writer, slo SLO, probes []searchProbe) {
+	sorted := append([]searchProbe(nil), probes...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Rate < sorted[j].Rate })
+
+	fmt.Fprintf(w, "| Rate per producer | Offered msg/sec | Produced msg/sec | Consumed msg/sec | P50 ms | P%g ms | Max ms | Drain | SLO |\n", slo.Percentile)
+	fmt.Fprintln(w, "| ---: | ---: | ---: | ---: | ---: | ---: | ---: | ---: | --- |")
+	for _, p := range sorted {
+		h := p.Result.Latencies.Corrected
+		verdict := "ok"
+		if p.Violation != "" {
+			verdict = "breaks: " + p.Violation
+		}
+		fmt.Fprintf(w, "| %d | %.0f | %.0f | %.0f | %s | %s | %s | %v | %s |\n", p.Rate, p.Offered, p.Achieved, p.Result.Throughput,
+			msf(h.Quantile(0.5)), msf(h.Quantile(slo.Percentile/100)), msf(h.Max()), time.Duration(p.Result.DrainTime).Round(time.Millisecond), verdict)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSearchRun(t *testing.T) {
+	errProbe := errors.New("probe failed")
+	for _, tt := range []struct {
+		name   string
+		search Search
+		limit  int // The highest sustainable rate.
+		failAt int // Probe of this rate fails (0 - none).
+		best   int
+		probes []int
+		err    error
+	}{
+		{
+			name:   "binary",
+			search: Search{Mode: searchBinary, MinRate: 100, MaxRate: 1000, Step: 10},
+			limit:  420,
+			best:   416,
+			probes: []int{100, 1000, 550, 325, 437, 381, 409, 423, 416},
+		},
+		{
+			name:   "binary exact resolution",
+			search: Search{Mode: searchBinary, MinRate: 1, MaxRate: 17, Step: 1},
+			limit:  5,
+			best:   5,
+			probes: []int{1, 17, 9, 5, 7, 6},
+		},
+		{
+			name:   "binary min breaks",
+			search: Search{Mode: searchBinary, MinRate: 100, MaxRate: 1000, Step: 10},
+			limit:  50,
+			best:   0,
+			probes: []int{100},
+		},
+		{
+			name:   "binary max sustainable",
+			search: Search{Mode: searchBinary, MinRate: 100, MaxRate: 1000, Step: 10},
+			limit:  5000,
+			best:   1000,
+			probes: []int{100, 1000},
+		},
+		{
+			name:   "binary probe error",
+			search: Search{Mode: searchBinary, MinRate: 100, MaxRate: 1000, Step: 10},
+			limit:  420,
+			failAt: 325,
+			best:   100,
+			probes: []int{100, 1000, 550, 325},
+			err:    errProbe,
+		},
+		{
+			name:   "step",
+			search: Search{Mode: searchStep, MinRate: 100, MaxRate: 500, Step: 100},
+			limit:  320,
+			best:   300,
+			probes: []int{100, 200, 300, 400},
+		},
+		{
+			name:   "step all sustainable",
+			search: Search{Mode: searchStep, MinRate: 100, MaxRate: 350, Step: 100},
+			limit:  1000,
+			best:   300,
+			probes: []int{100, 200, 300},
+		},
+		{
+			name:   "step probe error",
+			search: Search{Mode: searchStep, MinRate: 100, MaxRate: 500, Step: 100},
+			limit:  1000,
+			failAt: 200,
+			best:   100,
+			probes: []int{100, 200},
+			err:    errProbe,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var probes []int
+			best, err := tt.search.run(func(rate int) (bool, error) {
+				probes = append(probes, rate)
+				if rate == tt.failAt {
+					return false, errProbe
+				}
+				return rate <= tt.limit, nil
+			})
+			if best != tt.best || err != tt.err {
+				t.Errorf("got %d, %v, want %d, %v", best, err, tt.best, tt.err)
+			}
+			if !reflect.DeepEqual(probes, tt.probes) {
+				t.Errorf("probed %v, want %v", probes, tt.probes)
+			}
+		})
+	}
+}
+
+func TestSLOCheck(t *testing.T) {
+	slo := SLO{Percentile: 99, Latency: duration(10 * time.Millisecond)}
+	if err := slo.validate(); err != nil {
+		t.Fatal(err)
+	}
+	probe := func(latency time.Duration, change func(p *searchProbe)) searchProbe {
+		p := searchProbe{Offered: 1000, Achieved: 1000, Result: Result{Consumed: 100, Drained: true, Latencies: newProducerLatencies(3)}}
+		for i := 0; i < 100; i++ {
+			p.Result.Latencies.Corrected.Record(latency)
+		}
+		if change != nil {
+			change(&p)
+		}
+		return p
+	}
+	for _, tt := range []struct {
+		name string
+		p    searchProbe
+		want string
+	}{
+		{"met", probe(5*time.Millisecond, nil), ""},
+		{"latency", probe(20*time.Millisecond, nil), "P99 latency"},
+		{"nothing consumed", probe(time.Millisecond, func(p *searchProbe) { p.Result.Consumed = 0 }), "no messages consumed"},
+		{"missing", probe(time.Millisecond, func(p *searchProbe) { p.Result.Errors.Missing = 3 }), "3 messages missing"},
+		{"not drained", probe(time.Millisecond, func(p *searchProbe) { p.Result.Drained = false }), "not drained"},
+		{"slow drain", probe(time.Millisecond, func(p *searchProbe) { p.Result.DrainTime = duration(2 * time.Second) }), "took 2s to drain"},
+		{"producers behind", probe(time.Millisecond, func(p *searchProbe) { p.Achieved = 900 }), "produced 900 of 1000"},
+	} {
+		got := slo.check(tt.p)
+		if tt.want == "" && got != "" || !strings.Contains(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// seqRange is a half-open range [from, to) of sequence numbers.
+type seqRange struct {
+	from, to uint64
+}
+
+// streamStats tracks delivery of a single producer stream.
+// Sequence numbers that were skipped are kept as sorted ranges,
+// so a large gap costs the same memory as a small one.
+type streamStats struct {
+	next    uint64     // next expected sequence number
+	missing []seqRange // skipped sequence numbers not delivered (yet)
+	// First is the sequence number the stream was first seen at. Earlier
+	// messages are missing too, but likely sent before the consumer was
+	// ready (its partitions were not assigned yet).
+	First      uint64
+	Received   uint64
+	Gaps       uint64 // number of times the stream skipped ahead
+	Duplicates uint64
+	Reordered  uint64 // late deliveries filling a previously seen gap
+}
+
+func (s *streamStats) observe(seq uint64) {
+	first := s.Received == 0
+	s.Received++
+	switch {
+	case seq == s.next:
+		s.next++
+	case first:
+		s.First = seq
+		s.missing = append(s.missing, seqRange{from: 0, to: seq})
+		s.next = seq + 1
+	case seq > s.next:
+		s.Gaps++
+		s.missing = append(s.missing, seqRange{from: s.next, to: seq})
+		s.next = seq + 1
+	case s.fill(seq):
+		s.Reordered++
+	default:
+		s.Duplicates++
+	}
+}
+
+// fill removes seq from missing ranges, returns false if it was not missing.
+func (s *streamStats) fill(seq uint64) bool {
+	i := sort.Search(len(s.missing), func(i int) bool { return s.missing[i].to > seq })
+	if i == len(s.missing) || s.missing[i].from > seq {
+		return false
+	}
+
+	r := s.missing[i]
+	switch {
+	case r.to-r.from == 1:
+		s.missing = append(s.missing[:i], s.missing[i+1:]...)
+	case seq == r.from:
+		s.missing[i].from++
+	case seq == r.to-1:
+		s.missing[i].to--
+	default:
+		s.missing = append(s.missing, seqRange{})
+		copy(s.missing[i+2:], s.missing[i+1:])
+		s.missing[i] = seqRange{from: r.from, to: seq}
+		s.missing[i+1] = seqRange{from: seq + 1, to: r.to}
+	}
+
+	return true
+}
+
+// delivered reports whether seq was delivered at least once.
+func (s *streamStats) delivered(seq uint64) bool {
+	if seq >= s.next {
+		return false
+	}
+	i := sort.Search(len(s.missing), func(i int) bool { return s.missing[i].to > seq })
+	return i == len(s.missing) || s.missing[i].from > seq
+}
+
+// Missing returns number of sequence numbers skipped and never delivered.
+func (s *streamStats) Missing() uint64 {
+	return s.missingIn(0, math.MaxUint64)
+}
+
+// HeadMissing returns number of sequence numbers sent before the stream
+// was first seen and never delivered, they are counted in Missing too.
+func (s *streamStats) HeadMissing() uint64 {
+	return s.missingIn(0, s.First)
+}
+
+// missingIn returns number of skipped sequence numbers in [from, to).
+func (s *streamStats) missingIn(from, to uint64) uint64 {
+	var n uint64
+	for _, r := range s.missing {
+		lo, hi := max64(r.from, from), min64(r.to, to)
+		if lo < hi {
+			n += hi - lo
+		}
+	}
+	return n
+}
+
+// streamID identifies a producer stream, run id tells apart producers
+// of different processes.
+type streamID struct {
+	RunID      uint64
+	ProducerID uint32
+}
+
+// seqTracker checks per producer streams of one topic.
+type seqTracker struct {
+	mu      sync.Mutex
+	streams map[streamID]*streamStats
+	ends    map[streamID]producerCounts // Producer side counts of ended streams.
+	endedAt time.Time                   // When the last stream ended.
+}
+
+func newSeqTracker() *seqTracker {
+	return &seqTracker{streams: make(map[streamID]*streamStats), ends: make(map[streamID]producerCounts)}
+}
+
+// observe records delivery of e and reports whether its stream skipped
+// ahead or e was delivered before.
+func (t *seqTracker) observe(e Envelope) (gap, duplicate bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id := streamID{RunID: e.RunID, ProducerID: e.ProducerID}
+	s, ok := t.streams[id]
+	if !ok {
+		s = &streamStats{}
+		t.streams[id] = s
+	}
+	gaps, duplicates := s.Gaps, s.Duplicates
+	s.observe(e.Seq)
+	return s.Gaps > gaps, s.Duplicates > duplicates
+}
+
+// end records producer side counts of a stream that won't send anything else.
+func (t *seqTracker) end(id streamID, c producerCounts) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ends[id] = c
+	t.endedAt = time.Now()
+}
+
+// lastEnd returns when the last stream ended (zero time if none did).
+func (t *seqTracker) lastEnd() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.endedAt
+}
+
+// complete reports whether every stream seen so far ended and
+// all its acknowledged messages were delivered. Messages sent before
+// a stream was first seen are not waited for: they were most likely
+// sent before the consumer was ready and won't ever arrive.
+func (t *seqTracker) complete() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.ends) == 0 {
+		return false
+	}
+	for id := range t.streams {
+		if _, ok := t.ends[id]; !ok {
+			return false
+		}
+	}
+	for id, p := range t.ends {
+		s, ok := t.streams[id]
+		if !ok {
+			s = &streamStats{}
+		}
+		if undelivered(p, s, s.First, math.MaxUint64) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// producerStream is a snapshot of one producer stream stats.
+type producerStream struct {
+	streamID
+	streamStats
+	Counts producerCounts // Producer side counts, known once the stream ended.
+	Ended  bool
+}
+
+// Missing returns number of acknowledged messages never delivered
+// (skipped ones until the stream ends).
+func (s producerStream) Missing() uint64 {
+	if !s.Ended {
+		return s.streamStats.Missing()
+	}
+	return undelivered(s.Counts, &s.streamStats, 0, math.MaxUint64)
+}
+
+// HeadMissing returns number of acknowledged messages sent before
+// the stream was first seen and never delivered.
+func (s producerStream) HeadMissing() uint64 {
+	if !s.Ended {
+		return s.streamStats.HeadMissing()
+	}
+	return undelivered(s.Counts, &s.streamStats, 0, s.First)
+}
+
+// Streams returns snapshot of per producer stream stats ordered by run and producer id.
+func (t *seqTracker) Streams() []producerStream {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	res := make([]producerStream, 0, len(t.streams))
+	for id, s := range t.streams {
+		ps := producerStream{streamID: id, streamStats: *s}
+		ps.missing = append([]seqRange(nil), s.missing...)
+		ps.Counts, ps.Ended = t.ends[id]
+		res = append(res, ps)
+	}
+	for id, c := range t.ends {
+		if _, ok := t.streams[id]; !ok {
+			res = append(res, producerStream{streamID: id, Counts: c, Ended: true})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		a, b := res[i].streamID, res[j].streamID
+		return a.RunID < b.RunID || a.RunID == b.RunID && a.ProducerID < b.ProducerID
+	})
+
+	return res
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestStreamStats(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		seqs    []uint64
+		want    streamStats // Counters only.
+		missing uint64
+		head    uint64
+	}{
+		{"in order", []uint64{0, 1, 2, 3}, streamStats{Received: 4}, 0, 0},
+		{"gap", []uint64{0, 1, 4, 5}, streamStats{Received: 4, Gaps: 1}, 2, 0},
+		{"gaps", []uint64{0, 2, 4, 7}, streamStats{Received: 4, Gaps: 3}, 4, 0},
+		{"reordered", []uint64{0, 2, 1, 3}, streamStats{Received: 4, Gaps: 1, Reordered: 1}, 0, 0},
+		{"reordered within gap", []uint64{0, 5, 3, 1}, streamStats{Received: 4, Gaps: 1, Reordered: 2}, 2, 0},
+		{"reordered out of gaps", []uint64{0, 3, 6, 5, 1, 2, 4}, streamStats{Received: 7, Gaps: 2, Reordered: 4}, 0, 0},
+		{"duplicate", []uint64{0, 1, 1, 2}, streamStats{Received: 4, Duplicates: 1}, 0, 0},
+		{"duplicate of reordered", []uint64{0, 2, 1, 1, 2}, streamStats{Received: 5, Gaps: 1, Reordered: 1, Duplicates: 2}, 0, 0},
+		{"late start", []uint64{5, 6, 7}, streamStats{First: 5, Received: 3}, 5, 5},
+		{"late start with loss", []uint64{5, 6, 8, 9, 2}, streamStats{First: 5, Received: 5, Gaps: 1, Reordered: 1}, 5, 4},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &streamStats{}
+			for _, seq := range tt.seqs {
+				s.observe(seq)
+			}
+			got := *s
+			got.next, got.missing = 0, nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if got := s.Missing(); got != tt.missing {
+				t.Errorf("missing %d, want %d", got, tt.missing)
+			}
+			if got := s.HeadMissing(); got != tt.head {
+				t.Errorf("head missing %d, want %d", got, tt.head)
+			}
+		})
+	}
+}
+
+func TestUndelivered(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		seqs     []uint64
+		produced uint64
+		failed   []uint64
+		want     uint64
+		head     uint64 // Sent before the stream was first seen.
+	}{
+		{"all delivered", []uint64{0, 1, 2}, 3, nil, 0, 0},
+		{"nothing delivered", nil, 3, nil, 3, 0},
+		{"tail loss", []uint64{0, 1, 2}, 5, nil, 2, 0},
+		{"gap and tail loss", []uint64{0, 2}, 4, nil, 2, 0},
+		{"reordered", []uint64{0, 2, 1}, 3, nil, 0, 0},
+		{"failed tail", []uint64{0, 1, 2}, 5, []uint64{4}, 1, 0},
+		{"failed in gap", []uint64{0, 2}, 3, []uint64{1}, 0, 0},
+		{"failed but delivered", []uint64{0, 1, 2}, 3, []uint64{1}, 0, 0},
+		{"late start", []uint64{5, 6, 8, 9, 2}, 12, nil, 7, 4},
+		{"failed before first seen", []uint64{3, 4}, 5, []uint64{1}, 2, 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &streamStats{}
+			for _, seq := range tt.seqs {
+				s.observe(seq)
+			}
+			p := producerCounts{Produced: tt.produced, Acked: tt.produced - uint64(len(tt.failed)), failed: tt.failed}
+			if got := undelivered(p, s, 0, math.MaxUint64); got != tt.want {
+				t.Errorf("undelivered %d, want %d", got, tt.want)
+			}
+			if got := undelivered(p, s, 0, s.First); got != tt.head {
+				t.Errorf("undelivered head %d, want %d", got, tt.head)
+			}
+		})
+	}
+}
+
+func TestTopicAudit(t *testing.T) {
+	tracker := newSeqTracker()
+	observe := func(producer uint32, seqs ...uint64) {
+		for _, seq := range seqs {
+			tracker.observe(Envelope{RunID: 1, ProducerID: producer, Seq: seq})
+		}
+	}
+	observe(0, 0, 1, 1, 3)       // Duplicate, 2 and 4 lost.
+	observe(1, 2, 3, 4)          // Consumer was ready at 2.
+	observe(2, 0, 1, 2, 3, 4, 5) // Delivered in full.
+	if tracker.complete() {
+		t.Errorf("complete before streams ended")
+	}
+	for p := uint32(0); p < 3; p++ {
+		tracker.end(streamID{RunID: 1, ProducerID: p}, producerCounts{Produced: 5 + uint64(p)/2, Acked: 5 + uint64(p)/2})
+	}
+	tracker.end(streamID{RunID: 1, ProducerID: 3}, producerCounts{Produced: 2, Acked: 1, failed: []uint64{1}}) // Never seen.
+	if tracker.complete() {
+		t.Errorf("complete with missing messages")
+	}
+
+	got := newTopicAudit("t0", tracker.Streams())
+	want := topicAudit{Topic: "t0", Produced: 18, Acked: 17, Consumed: 13, Missing: 5, HeadMissing: 2, Duplicated: 1}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestCompleteLateStart(t *testing.T) {
+	tracker := newSeqTracker()
+	for seq := uint64(2); seq < 5; seq++ {
+		tracker.observe(Envelope{RunID: 1, Seq: seq})
+	}
+	tracker.end(streamID{RunID: 1}, producerCounts{Produced: 5, Acked: 5})
+	if !tracker.complete() {
+		t.Errorf("drain waits for messages sent before the stream was first seen")
+	}
+	if got := tracker.Streams()[0].Missing(); got != 2 {
+		t.Errorf("missing %d, want 2", got)
+	}
+}
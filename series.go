@@ -0,0 +1,410 @@
+package main
+
+import (
+	"encoding/csv"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gonum.org/v1/gonum/stat"
+)
+
+// Series interval phases.
+const (
+	phaseWarmup   = "warmup" // Before the measurement window.
+	phaseMeasure  = "measure"
+	phaseCooldown = "cooldown" // After the measurement window, producers still run.
+	phaseDrain    = "drain"    // Producers stopped, in-flight messages arrive.
+)
+
+// Series is throughput and latency of every interval of a run,
+// it shows stalls and warmup that percentiles of the whole run hide.
+type Series struct {
+	Interval duration `json:"interval"`
+	// Measurement window (by intended send time of measured messages) and the
+	// time the last producer stopped, all since the run start.
+	MeasureStart duration      `json:"measure_start"`
+	MeasureEnd   duration      `json:"measure_end"`
+	DrainStart   duration      `json:"drain_start"`
+	Points       []SeriesPoint `json:"points"`
+}
+
+// SeriesPoint is a single interval of Series.
+type SeriesPoint struct {
+	Start         duration `json:"start"` // Since the run start.
+	Phase         string   `json:"phase"` // Where the middle of the interval falls.
+	Produced      uint64   `json:"produced"`
+	Acked         uint64   `json:"acked"`
+	Failed        uint64   `json:"failed"`
+	Consumed      uint64   `json:"consumed"`
+	ConsumedBytes uint64   `json:"consumed_bytes"`
+	Gaps          uint64   `json:"gaps"`
+	Duplicates    uint64   `json:"duplicates"`
+	Throughput    float64  `json:"throughput"` // Consumed messages per second.
+	// Latency is of all messages received in the interval, measured or not.
+	Latency Percentiles `json:"latency"`
+}
+
+// Series recorder capacity: intervals beyond it are counted in the last one.
+const (
+	seriesChunk     = 256  // Intervals allocated at once.
+	maxSeriesChunks = 1024 // Three days at 1s interval.
+)
+
+// intervalCounters are counts of a single interval.
+type intervalCounters struct {
+	produced, acked, failed atomic.Uint64
+	consumed, consumedBytes atomic.Uint64
+	gaps, duplicates        atomic.Uint64
+}
+
+// seriesRecorder collects Series of a run, shared by all topics. Counters
+// of every interval are atomic, so producers and consumers don't contend
+// for a lock. Latency is recorded by per topic shards, and only the
+// histogram of the current interval is kept: once an interval is over,
+// tick summarizes it.
+//
+// It also detects steady state if configured, see checkSteady.
+type seriesRecorder struct {
+	start     time.Time
+	interval  time.Duration
+	precision int
+	chunks    [maxSeriesChunks]atomic.Pointer[[seriesChunk]intervalCounters]
+
+	// Measurement window (by intended send time) and the time the last
+	// producer stopped, UnixNano, 0 until known.
+	measureStart, measureEnd, drainStart atomic.Int64
+
+	mu      sync.Mutex // Guards latency summaries and shards.
+	shards  []*seriesShard
+	pending map[int]*Histogram // Latency of intervals not summarized yet.
+	latency []Percentiles      // Latency of summarized intervals.
+
+	steady      *SteadyState // nil - no detection.
+	warmupEnd   time.Time    // Detection window starts after it.
+	produceOnly bool         // Nothing is consumed, only throughput is tested.
+	steadyAt    atomic.Int64 // UnixNano, 0 until steady state is detected.
+}
+
+func newSeriesRecorder(start time.Time, cfg Config) *seriesRecorder {
+	r := &seriesRecorder{
+		start:       start,
+		interval:    cfg.Interval,
+		precision:   cfg.Precision,
+		pending:     make(map[int]*Histogram),
+		steady:      cfg.Steady,
+		produceOnly: cfg.Role == roleProduce,
+	}
+	r.warmupEnd = start
+	if cfg.Warmup > 0 {
+		r.warmupEnd = start.Add(cfg.Warmup)
+	}
+	return r
+}
+
+func (r *seriesRecorder) index(t time.Time) int {
+	if t.Before(r.start) {
+		return 0
+	}
+	i := int(t.Sub(r.start) / r.interval)
+	if i >= seriesChunk*maxSeriesChunks {
+		return seriesChunk*maxSeriesChunks - 1
+	}
+	return i
+}
+
+// counters returns counters of interval i.
+func (r *seriesRecorder) counters(i int) *intervalCounters {
+	chunk := &r.chunks[i/seriesChunk]
+	c := chunk.Load()
+	if c == nil {
+		chunk.CompareAndSwap(nil, new([seriesChunk]intervalCounters))
+		c = chunk.Load()
+	}
+	return &c[i%seriesChunk]
+}
+
+// produced records a produce call started at t.
+func (r *seriesRecorder) produced(t time.Time) {
+	r.counters(r.index(t)).produced.Add(1)
+}
+
+// acked records produce call completed at t.
+func (r *seriesRecorder) acked(t time.Time, err error) {
+	c := r.counters(r.index(t))
+	if err != nil {
+		c.failed.Add(1)
+	} else {
+		c.acked.Add(1)
+	}
+}
+
+// measured records intended send time of a measured message.
+func (r *seriesRecorder) measured(intended time.Time) {
+	t := intended.UnixNano()
+	for {
+		s := r.measureStart.Load()
+		if s != 0 && s <= t || r.measureStart.CompareAndSwap(s, t) {
+			break
+		}
+	}
+	storeMax(&r.measureEnd, t)
+}
+
+// stopped records the time producers of a topic stopped.
+func (r *seriesRecorder) stopped(t time.Time) {
+	storeMax(&r.drainStart, t.UnixNano())
+}
+
+// storeMax sets v to x if x is larger.
+func storeMax(v *atomic.Int64, x int64) {
+	for {
+		old := v.Load()
+		if old >= x || v.CompareAndSwap(old, x) {
+			return
+		}
+	}
+}
+
+// seriesShard records latency of messages of one topic.
+type seriesShard struct {
+	r   *seriesRecorder
+	mu  sync.Mutex
+	cur int        // Interval the histogram belongs to.
+	h   *Histogram // Late samples go to the current interval.
+}
+
+// shard returns a new latency shard.
+func (r *seriesRecorder) shard() *seriesShard {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := &seriesShard{r: r, h: NewHistogram(r.precision)}
+	r.shards = append(r.shards, s)
+	return s
+}
+
+// consumed records message received at t.
+func (s *seriesShard) consumed(t time.Time, size int, latency time.Duration, gap, duplicate bool) {
+	i := s.r.index(t)
+	c := s.r.counters(i)
+	c.consumed.Add(1)
+	c.consumedBytes.Add(uint64(size))
+	if gap {
+		c.gaps.Add(1)
+	}
+	if duplicate {
+		c.duplicates.Add(1)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i > s.cur {
+		s.flush()
+		s.cur = i
+	}
+	s.h.Record(latency)
+}
+
+// flush hands latency of the shard interval over to the recorder, the caller holds the shard lock.
+func (s *seriesShard) flush() {
+	if s.h.Count() == 0 {
+		return
+	}
+	r := s.r
+	r.mu.Lock()
+	i := s.cur
+	if i < len(r.latency) {
+		i = len(r.latency) // Already summarized, late samples go to the current interval.
+	}
+	h, ok := r.pending[i]
+	if !ok {
+		h = NewHistogram(r.precision)
+		r.pending[i] = h
+	}
+	h.Merge(s.h)
+	r.mu.Unlock()
+	s.h.Reset()
+}
+
+// summarize flushes all shards and summarizes latency of intervals before i.
+func (r *seriesRecorder) summarize(i int) {
+	r.mu.Lock()
+	shards := append([]*seriesShard(nil), r.shards...)
+	r.mu.Unlock()
+	for _, s := range shards {
+		s.mu.Lock()
+		s.flush()
+		if i > s.cur {
+			s.cur = i
+		}
+		s.mu.Unlock()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for len(r.latency) < i {
+		p := Percentiles{}
+		if h, ok := r.pending[len(r.latency)]; ok {
+			p = newPercentiles(h)
+			delete(r.pending, len(r.latency))
+		}
+		r.latency = append(r.latency, p)
+	}
+}
+
+// tick summarizes intervals that are over and checks steady state,
+// it is called every interval.
+func (r *seriesRecorder) tick(now time.Time) {
+	r.summarize(r.index(now))
+	r.checkSteady(now)
+}
+
+// checkSteady tests whether the last complete intervals spanning steady
+// state window are stable: both throughput and P50 latency have coefficient
+// of variation within tolerance. Measurement starts once they are, messages
+// of the window itself have already been left out.
+func (r *seriesRecorder) checkSteady(now time.Time) {
+	if r.steady == nil || r.steadyAt.Load() != 0 {
+		return
+	}
+	i := r.index(now)
+	first := i - int(time.Duration(r.steady.Window)/r.interval)
+	if first < 0 || r.start.Add(time.Duration(first)*r.interval).Before(r.warmupEnd) {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rate, p50 []float64
+	for j := first; j < i; j++ {
+		c := r.counters(j)
+		if r.produceOnly {
+			rate = append(rate, float64(c.acked.Load()))
+			continue
+		}
+		if j >= len(r.latency) || r.latency[j].Count == 0 {
+			return
+		}
+		rate = append(rate, float64(c.consumed.Load()))
+		p50 = append(p50, r.latency[j].P50)
+	}
+	if !stable(rate, r.steady.Tolerance) || !r.produceOnly && !stable(p50, r.steady.Tolerance) {
+		return
+	}
+	r.steadyAt.Store(now.UnixNano())
+	log.Printf("Steady state reached after %v", now.Sub(r.start).Round(time.Millisecond))
+}
+
+// stable reports whether coefficient of variation of x is within tolerance.
+func stable(x []float64, tolerance float64) bool {
+	mean, std := stat.MeanStdDev(x, nil)
+	return mean > 0 && std/mean <= tolerance
+}
+
+// inSteady reports whether message intended at t is in steady state,
+// always true without steady state detection.
+func (r *seriesRecorder) inSteady(t time.Time) bool {
+	if r.steady == nil {
+		return true
+	}
+	at := r.steadyAt.Load()
+	return at != 0 && t.UnixNano() >= at
+}
+
+// steadyTime returns when steady state was detected since the run start (0 - not reached).
+func (r *seriesRecorder) steadyTime() time.Duration {
+	at := r.steadyAt.Load()
+	if at == 0 {
+		return 0
+	}
+	return time.Unix(0, at).Sub(r.start)
+}
+
+// series returns Series of a run that ended at end.
+func (r *seriesRecorder) series(end time.Time) *Series {
+	n := r.index(end) + 1
+	r.summarize(n)
+
+	s := &Series{Interval: duration(r.interval)}
+	at := func(v *atomic.Int64) time.Time {
+		if ns := v.Load(); ns != 0 {
+			return time.Unix(0, ns)
+		}
+		return time.Time{}
+	}
+	measureStart, measureEnd, drainStart := at(&r.measureStart), at(&r.measureEnd), at(&r.drainStart)
+	since := func(t time.Time) duration {
+		if t.IsZero() {
+			return 0
+		}
+		return duration(t.Sub(r.start))
+	}
+	s.MeasureStart, s.MeasureEnd, s.DrainStart = since(measureStart), since(measureEnd), since(drainStart)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := 0; i < n; i++ {
+		c := r.counters(i)
+		p := SeriesPoint{
+			Start:         duration(time.Duration(i) * r.interval),
+			Produced:      c.produced.Load(),
+			Acked:         c.acked.Load(),
+			Failed:        c.failed.Load(),
+			Consumed:      c.consumed.Load(),
+			ConsumedBytes: c.consumedBytes.Load(),
+			Gaps:          c.gaps.Load(),
+			Duplicates:    c.duplicates.Load(),
+			Latency:       r.latency[i],
+		}
+		from := r.start.Add(time.Duration(p.Start))
+		to := from.Add(r.interval)
+		if to.After(end) {
+			to = end // The last interval is cut short.
+		}
+		if length := to.Sub(from); length > 0 {
+			p.Throughput = float64(p.Consumed) / length.Seconds()
+		}
+
+		mid := from.Add(to.Sub(from) / 2)
+		switch {
+		case !drainStart.IsZero() && !mid.Before(drainStart):
+			p.Phase = phaseDrain
+		case measureStart.IsZero() || mid.Before(measureStart):
+			p.Phase = phaseWarmup
+		case mid.After(measureEnd):
+			p.Phase = phaseCooldown
+		default:
+			p.Phase = phaseMeasure
+		}
+		s.Points = append(s.Points, p)
+	}
+
+	return s
+}
+
+// writeSeries writes series as CSV, a row per interval.
+func writeSeries(path string, s *Series) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"start_s", "phase", "produced", "acked", "failed", "consumed", "consumed_bytes", "gaps", "duplicates",
+		"messages_per_sec", "p50_ms", "p99_ms", "max_ms"})
+	u := func(v uint64) string { return strconv.FormatUint(v, 10) }
+	f3 := func(v float64) string { return strconv.FormatFloat(v, 'f', 3, 64) }
+	for _, p := range s.Points {
+		w.Write([]string{f3(time.Duration(p.Start).Seconds()), p.Phase, u(p.Produced), u(p.Acked), u(p.Failed), u(p.Consumed),
+			u(p.ConsumedBytes), u(p.Gaps), u(p.Duplicates), f3(p.Throughput), f3(p.Latency.P50), f3(p.Latency.P99), f3(p.Latency.Max)})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSeriesRecorder(t *testing.T) {
+	start := time.Unix(1000, 0)
+	at := func(s float64) time.Time { return start.Add(time.Duration(s * float64(time.Second))) }
+	r := newSeriesRecorder(start, Config{Interval: time.Second, Precision: 3})
+	shard := r.shard()
+
+	r.produced(at(0.1))
+	r.produced(at(0.2))
+	r.acked(at(0.3), nil)
+	r.acked(at(0.4), errors.New("timeout"))
+	shard.consumed(at(0.5), 100, 10*time.Millisecond, false, false)
+	r.tick(at(1))
+	// Late sample of a summarized interval goes to the current one.
+	shard.consumed(at(0.9), 100, 50*time.Millisecond, false, false)
+	shard.consumed(at(1.5), 200, 20*time.Millisecond, true, false)
+	shard.consumed(at(1.7), 200, 30*time.Millisecond, false, true)
+	shard.consumed(at(3.2), 300, 40*time.Millisecond, false, false)
+
+	r.measured(at(2.4))
+	r.measured(at(1.2))
+	r.stopped(at(2.9))
+	r.stopped(at(3))
+	s := r.series(at(3.5))
+
+	if s.MeasureStart != duration(1200*time.Millisecond) || s.MeasureEnd != duration(2400*time.Millisecond) || s.DrainStart != duration(3*time.Second) {
+		t.Errorf("measure %v-%v, drain %v, want 1.2s-2.4s and 3s", time.Duration(s.MeasureStart), time.Duration(s.MeasureEnd), time.Duration(s.DrainStart))
+	}
+	for i, want := range []struct {
+		phase                                    string
+		produced, acked, failed, consumed, bytes uint64
+		gaps, duplicates                         uint64
+		latencies                                int64
+		throughput                               float64
+	}{
+		{phaseWarmup, 2, 1, 1, 2, 200, 0, 0, 1, 2},
+		{phaseMeasure, 0, 0, 0, 2, 400, 1, 1, 3, 2},
+		{phaseCooldown, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		{phaseDrain, 0, 0, 0, 1, 300, 0, 0, 1, 2}, // Half an interval long.
+	} {
+		if i >= len(s.Points) {
+			t.Fatalf("%d intervals, want 4", len(s.Points))
+		}
+		p := s.Points[i]
+		got := want
+		got.phase, got.produced, got.acked, got.failed, got.consumed, got.bytes = p.Phase, p.Produced, p.Acked, p.Failed, p.Consumed, p.ConsumedBytes
+		got.gaps, got.duplicates, got.latencies, got.throughput = p.Gaps, p.Duplicates, p.Latency.Count, p.Throughput
+		if got != want {
+			t.Errorf("interval %d: got %+v, want %+v", i, got, want)
+		}
+	}
+	if p50 := s.Points[0].Latency.P50; p50 < 9.9 || p50 > 10.1 {
+		t.Errorf("interval 0 P50 %vms, want 10ms", p50)
+	}
+	if top := s.Points[1].Latency.Max; top < 49.9 || top > 50.1 {
+		t.Errorf("interval 1 max %vms, want the late 50ms sample", top)
+	}
+
+	path := filepath.Join(t.TempDir(), "series.csv")
+	if err := writeSeries(path, s); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 5 || rows[0][0] != "start_s" || rows[4][0] != "3.000" || rows[4][1] != phaseDrain || rows[4][9] != "2.000" {
+		t.Errorf("CSV %v, want header and a row per interval", rows)
+	}
+}
+
+func TestSeriesRecorderCapacity(t *testing.T) {
+	start := time.Unix(1000, 0)
+	r := newSeriesRecorder(start, Config{Interval: time.Second, Precision: 3})
+	last := seriesChunk*maxSeriesChunks - 1
+	if i := r.index(start.Add(-time.Second)); i != 0 {
+		t.Errorf("time before the start is in interval %d, want 0", i)
+	}
+	if i := r.index(start.Add(time.Duration(last+100) * time.Second)); i != last {
+		t.Errorf("time beyond capacity is in interval %d, want the last one %d", i, last)
+	}
+	r.produced(start.Add(time.Duration(last+100) * time.Second))
+	if n := r.counters(last).produced.Load(); n != 1 {
+		t.Errorf("last interval counted %d messages, want 1", n)
+	}
+}
+
+func TestSteadyState(t *testing.T) {
+	start := time.Unix(1000, 0)
+	at := func(s float64) time.Time { return start.Add(time.Duration(s * float64(time.Second))) }
+	steady := &SteadyState{Window: duration(3 * time.Second), Tolerance: 0.1}
+	for _, tt := range []struct {
+		name   string
+		cfg    Config
+		counts []int   // Messages of every interval, 10ms latency.
+		want   float64 // Steady state time, s.
+	}{
+		{"ramp up", Config{}, []int{10, 50, 100, 100, 95, 105, 100}, 5},
+		{"after warmup", Config{Warmup: 3 * time.Second}, []int{100, 100, 100, 100, 100, 100, 100}, 6},
+		{"unstable", Config{}, []int{100, 50, 100, 50, 100, 50, 100}, 0},
+		{"produce only", Config{Role: roleProduce}, []int{10, 100, 100, 100, 100, 100, 100}, 4},
+	} {
+		tt.cfg.Interval, tt.cfg.Precision, tt.cfg.Steady = time.Second, 3, steady
+		r := newSeriesRecorder(start, tt.cfg)
+		shard := r.shard()
+		for i, n := range tt.counts {
+			for j := 0; j < n; j++ {
+				ts := at(float64(i) + float64(j)/float64(n))
+				if tt.cfg.Role == roleProduce {
+					r.acked(ts, nil)
+				} else {
+					shard.consumed(ts, 100, 10*time.Millisecond, false, false)
+				}
+			}
+			r.tick(at(float64(i + 1)))
+		}
+
+		got := time.Duration(tt.want * float64(time.Second))
+		if st := r.steadyTime(); st != got {
+			t.Errorf("%s: steady state at %v, want %v", tt.name, st, got)
+		}
+		if got == 0 {
+			if r.inSteady(at(10)) {
+				t.Errorf("%s: message in steady state that was never reached", tt.name)
+			}
+			continue
+		}
+		if r.inSteady(at(tt.want-0.001)) || !r.inSteady(at(tt.want)) {
+			t.Errorf("%s: messages before steady state are measured or after it are not", tt.name)
+		}
+	}
+
+	r := newSeriesRecorder(start, Config{Interval: time.Second, Precision: 3})
+	if !r.inSteady(start) || r.steadyTime() != 0 {
+		t.Errorf("without detection all messages are in steady state")
+	}
+}
+
+func TestStable(t *testing.T) {
+	for _, tt := range []struct {
+		x    []float64
+		want bool
+	}{
+		{[]float64{100, 100, 100}, true},
+		{[]float64{95, 100, 105}, true},
+		{[]float64{50, 100, 150}, false},
+		{[]float64{0, 0, 0}, false},
+	} {
+		if got := stable(tt.x, 0.1); got != tt.want {
+			t.Errorf("stable(%v) = %v, want %v", tt.x, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"math/bits"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sizeDist generates message sizes (in bytes, including envelope).
+type sizeDist interface {
+	next(rnd *rand.Rand) int
+	max() int
+	String() string
+}
+
+// maxMsgSize caps generated message sizes.
+const maxMsgSize = 16 << 20
+
+// parseSizeDist parses message size distribution spec:
+//
+//	fixed:SIZE
+//	uniform:MIN,MAX
+//	lognormal:MEDIAN,SIGMA[,MAX]
+//	empirical:FILE (lines of "SIZE WEIGHT")
+func parseSizeDist(spec string) (sizeDist, error) {
+	kind, args, _ := strings.Cut(spec, ":")
+	var nums []float64
+	if kind != "empirical" && args != "" {
+		for _, a := range strings.Split(args, ",") {
+			n, err := strconv.ParseFloat(strings.TrimSpace(a), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s size distribution parameter %q", kind, a)
+			}
+			nums = append(nums, n)
+		}
+	}
+
+	switch kind {
+	case "fixed":
+		if len(nums) != 1 || nums[0] < 1 {
+			return nil, fmt.Errorf("fixed size distribution wants one positive size, got %q", args)
+		}
+		return fixedSize(nums[0]), nil
+	case "uniform":
+		if len(nums) != 2 || nums[0] < 1 || nums[1] < nums[0] {
+			return nil, fmt.Errorf("uniform size distribution wants MIN,MAX with 0 < MIN <= MAX, got %q", args)
+		}
+		return uniformSize{lo: int(nums[0]), hi: int(nums[1])}, nil
+	case "lognormal":
+		if len(nums) < 2 || len(nums) > 3 || nums[0] < 1 || nums[1] <= 0 {
+			return nil, fmt.Errorf("lognormal size distribution wants MEDIAN,SIGMA[,MAX] with positive values, got %q", args)
+		}
+		d := lognormalSize{median: nums[0], sigma: nums[1], limit: maxMsgSize}
+		if len(nums) == 3 {
+			d.limit = int(nums[2])
+		}
+		return d, nil
+	case "empirical":
+		return loadEmpiricalSize(args)
+	}
+
+	return nil, fmt.Errorf("unknown size distribution %q (want fixed, uniform, lognormal or empirical)", kind)
+}
+
+type fixedSize int
+
+func (d fixedSize) next(*rand.Rand) int { return int(d) }
+func (d fixedSize) max() int            { return int(d) }
+func (d fixedSize) String() string      { return fmt.Sprintf("fixed:%d", int(d)) }
+
+type uniformSize struct {
+	lo, hi int
+}
+
+func (d uniformSize) next(rnd *rand.Rand) int { return d.lo + rnd.Intn(d.hi-d.lo+1) }
+func (d uniformSize) max() int                { return d.hi }
+func (d uniformSize) String() string          { return fmt.Sprintf("uniform:%d,%d", d.lo, d.hi) }
+
+type lognormalSize struct {
+	median, sigma float64
+	limit         int
+}
+
+func (d lognormalSize) next(rnd *rand.Rand) int {
+	n := int(d.median * math.Exp(d.sigma*rnd.NormFloat64()))
+	if n < 1 {
+		return 1
+	}
+	if n > d.limit {
+		return d.limit
+	}
+	return n
+}
+func (d lognormalSize) max() int { return d.limit }
+func (d lognormalSize) String() string {
+	return fmt.Sprintf("lognormal:%g,%g,%d", d.median, d.sigma, d.limit)
+}
+
+// empiricalSize samples sizes from a histogram with given weights.
+type empiricalSize struct {
+	file  string
+	sizes []int
+	cum   []float64 // cumulative weights
+}
+
+func loadEmpiricalSize(path string) (sizeDist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open size histogram: %w", err)
+	}
+	defer f.Close()
+
+	d := empiricalSize{file: path}
+	total := 0.0
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want \"SIZE WEIGHT\"", path, line)
+		}
+		size, err := strconv.Atoi(fields[0])
+		if err != nil || size < 1 || size > maxMsgSize {
+			return nil, fmt.Errorf("%s:%d: invalid size %q", path, line, fields[0])
+		}
+		w, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("%s:%d: invalid weight %q", path, line, fields[1])
+		}
+		total += w
+		d.sizes = append(d.sizes, size)
+		d.cum = append(d.cum, total)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read size histogram: %w", err)
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("size histogram %s has no weights", path)
+	}
+
+	return d, nil
+}
+
+func (d empiricalSize) next(rnd *rand.Rand) int {
+	w := rnd.Float64() * d.cum[len(d.cum)-1]
+	return d.sizes[sort.Search(len(d.cum), func(i int) bool { return d.cum[i] > w })]
+}
+
+func (d empiricalSize) max() int {
+	m := 0
+	for _, s := range d.sizes {
+		if s > m {
+			m = s
+		}
+	}
+	return m
+}
+
+func (d empiricalSize) String() string { return "empirical:" + d.file }
+
+// sizeBucket returns power of two bucket of message size:
+// bucket n holds sizes in (2^(n-1), 2^n] range.
+func sizeBucket(size int) int {
+	if size <= 1 {
+		return 0
+	}
+	return bits.Len(uint(size - 1))
+}
+
+// sizeBucketName returns human readable size bucket range.
+func sizeBucketName(b int) string {
+	if b == 0 {
+		return "1B"
+	}
+	return fmt.Sprintf("%s-%s", formatBytes(1<<(b-1)+1), formatBytes(1<<b))
+}
+
+func formatBytes(n int) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%dMiB", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%dKiB", n>>10)
+	}
+	return fmt.Sprintf("%dB", n)
+}
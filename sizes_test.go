@@ -0,0 +1,148 @@
+package main
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestParseSizeDist(t *testing.T) {
+	hist := filepath.Join(t.TempDir(), "sizes.txt")
+	if err := os.WriteFile(hist, []byte("# size weight\n100 3\n\n1000,1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		spec string
+		want string // Canonical spec, empty if invalid.
+		max  int
+	}{
+		{"fixed:128", "fixed:128", 128},
+		{"uniform:10,20", "uniform:10,20", 20},
+		{"lognormal:1000,0.5", "lognormal:1000,0.5,16777216", maxMsgSize},
+		{"lognormal:1000,0.5,4096", "lognormal:1000,0.5,4096", 4096},
+		{"empirical:" + hist, "empirical:" + hist, 1000},
+		{"fixed:0", "", 0},
+		{"fixed:1,2", "", 0},
+		{"uniform:20,10", "", 0},
+		{"lognormal:1000", "", 0},
+		{"lognormal:1000,0", "", 0},
+		{"empirical:" + filepath.Join(t.TempDir(), "none.txt"), "", 0},
+		{"normal:100,10", "", 0},
+		{"fixed:abc", "", 0},
+	} {
+		d, err := parseSizeDist(tt.spec)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%s: accepted, want error", tt.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.spec, err)
+			continue
+		}
+		if d.String() != tt.want || d.max() != tt.max {
+			t.Errorf("%s: got %s with max %d, want %s with max %d", tt.spec, d, d.max(), tt.want, tt.max)
+		}
+	}
+}
+
+func TestEmpiricalSizeErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"fields": "100\n",
+		"size":   "0 1\n",
+		"weight": "100 -1\n",
+		"empty":  "# nothing\n",
+		"zero":   "100 0\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadEmpiricalSize(path); err == nil {
+			t.Errorf("%s: histogram %q accepted", name, content)
+		}
+	}
+}
+
+func TestSizeDistSamples(t *testing.T) {
+	hist := filepath.Join(t.TempDir(), "sizes.txt")
+	if err := os.WriteFile(hist, []byte("100 3\n1000 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	const n = 100000
+	for _, tt := range []struct {
+		spec     string
+		min, max int
+		median   int // Expected median within 5%.
+	}{
+		{"fixed:128", 128, 128, 128},
+		{"uniform:100,200", 100, 200, 150},
+		{"lognormal:1000,0.5,4096", 1, 4096, 1000},
+		{"empirical:" + hist, 100, 1000, 100},
+	} {
+		d, err := parseSizeDist(tt.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rnd := rand.New(rand.NewSource(1))
+		sizes := make([]int, n)
+		for i := range sizes {
+			sizes[i] = d.next(rnd)
+		}
+		sort.Ints(sizes)
+		if sizes[0] < tt.min || sizes[n-1] > tt.max {
+			t.Errorf("%s: sizes in [%d, %d], want within [%d, %d]", tt.spec, sizes[0], sizes[n-1], tt.min, tt.max)
+		}
+		if m := sizes[n/2]; m < tt.median*95/100 || m > tt.median*105/100 {
+			t.Errorf("%s: median %d, want about %d", tt.spec, m, tt.median)
+		}
+	}
+}
+
+func TestEmpiricalSizeWeights(t *testing.T) {
+	hist := filepath.Join(t.TempDir(), "sizes.txt")
+	if err := os.WriteFile(hist, []byte("100 3\n1000 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	d, err := loadEmpiricalSize(hist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rnd := rand.New(rand.NewSource(1))
+	small := 0
+	for i := 0; i < 100000; i++ {
+		if d.next(rnd) == 100 {
+			small++
+		}
+	}
+	if small < 74000 || small > 76000 {
+		t.Errorf("%d of 100000 sizes are 100, want about 75%%", small)
+	}
+}
+
+func TestSizeBucket(t *testing.T) {
+	for _, tt := range []struct {
+		size   int
+		bucket int
+		name   string
+	}{
+		{1, 0, "1B"},
+		{2, 1, "2B-2B"},
+		{100, 7, "65B-128B"},
+		{128, 7, "65B-128B"},
+		{129, 8, "129B-256B"},
+		{1 << 20, 20, "524289B-1MiB"},
+	} {
+		b := sizeBucket(tt.size)
+		if b != tt.bucket {
+			t.Errorf("sizeBucket(%d) = %d, want %d", tt.size, b, tt.bucket)
+		}
+		if name := sizeBucketName(b); name != tt.name {
+			t.Errorf("sizeBucketName(%d) = %s, want %s", b, name, tt.name)
+		}
+	}
+}
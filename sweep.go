@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"streambench/brokers"
+)
+
+// Sweep runs base scenario for every combination of parameter values.
+type Sweep struct {
+	Scenario    string      `json:"scenario"` // Base scenario file, relative to the sweep file.
+	Axes        []sweepAxis `json:"axes"`
+	Cooldown    duration    `json:"cooldown,omitempty"`     // Pause between runs.
+	ResetTopics bool        `json:"reset_topics,omitempty"` // Recreate topics empty before each run.
+}
+
+// sweepAxis is a scenario parameter and values it takes.
+type sweepAxis struct {
+	// Param is scenario field path like "driver", "options.acks" or "groups[0].producers".
+	Param  string            `json:"param"`
+	Values []json.RawMessage `json:"values"`
+}
+
+// sweepRun is a single combination of axis values.
+type sweepRun struct {
+	values []string // Value per axis.
+	cfg    Config
+	result Result
+}
+
+// runSweep implements "sweep" command.
+func runSweep(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("sweep", flag.ExitOnError)
+	out := fs.String("out", "", "file to write comparative table to (stdout only if empty)")
+	precision := fs.Int("hist_precision", defaultPrecision, "latency histogram precision (significant decimal digits, 1-3), each histogram takes about 188KB at 3")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s sweep [flags] SWEEP_FILE\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *precision < 1 || *precision > maxPrecision {
+		log.Fatalf("-hist_precision must be in 1..%d range", maxPrecision)
+	}
+
+	sweep, runs, err := loadSweep(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Invalid sweep: %v", err)
+	}
+
+	done := make([]sweepRun, 0, len(runs))
+	for i, run := range runs {
+		if i > 0 && sweep.Cooldown > 0 {
+			log.Printf("Cooling down for %v", time.Duration(sweep.Cooldown))
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Duration(sweep.Cooldown)):
+			}
+		}
+		if ctx.Err() != nil {
+			log.Printf("Sweep interrupted, %d of %d runs done", len(done), len(runs))
+			break
+		}
+
+		log.Printf("Sweep run %d/%d: %s", i+1, len(runs), sweepLabel(sweep.Axes, run.values))
+		if sweep.ResetTopics {
+			if err := resetTopics(ctx, run.cfg); err != nil {
+				log.Fatalf("failed to reset topics: %v", err)
+			}
+		}
+		run.cfg.Precision = *precision
+		var err error
+		if run.result, err = RunBench(ctx, run.cfg); err != nil {
+			log.Fatalf("Sweep run %d failed: %v", i+1, err)
+		}
+		done = append(done, run)
+	}
+
+	var table bytes.Buffer
+	writeSweepTable(&table, sweep.Axes, done)
+	fmt.Print(table.String())
+	if *out != "" {
+		if err := os.WriteFile(*out, table.Bytes(), 0o644); err != nil {
+			log.Fatalf("failed to write sweep table: %v", err)
+		}
+	}
+}
+
+// loadSweep reads sweep file and resolves scenarios of all runs,
+// so an invalid combination is reported before anything runs.
+func loadSweep(path string) (Sweep, []sweepRun, error) {
+	var sweep Sweep
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return sweep, nil, fmt.Errorf("failed to read sweep: %w", err)
+	}
+	if err := decodeStrict(path, b, &sweep); err != nil {
+		return sweep, nil, err
+	}
+
+	if sweep.Scenario == "" {
+		return sweep, nil, fmt.Errorf("scenario: base scenario file required")
+	}
+	sweep.Scenario = relativeTo(path, sweep.Scenario)
+	base, err := os.ReadFile(sweep.Scenario)
+	if err != nil {
+		return sweep, nil, fmt.Errorf("failed to read base scenario: %w", err)
+	}
+	if sweep.Cooldown < 0 {
+		return sweep, nil, fmt.Errorf("cooldown: can't be negative")
+	}
+	if len(sweep.Axes) == 0 {
+		return sweep, nil, fmt.Errorf("axes: at least one axis required")
+	}
+	seen := make(map[string]bool)
+	for i, a := range sweep.Axes {
+		if a.Param == "" {
+			return sweep, nil, fmt.Errorf("axes[%d].param: required", i)
+		}
+		if seen[a.Param] {
+			return sweep, nil, fmt.Errorf("axes[%d].param: %s is already swept", i, a.Param)
+		}
+		seen[a.Param] = true
+		if len(a.Values) == 0 {
+			return sweep, nil, fmt.Errorf("axes[%d].values: at least one value required", i)
+		}
+	}
+
+	// Cartesian product, the last axis changes fastest.
+	var runs []sweepRun
+	idx := make([]int, len(sweep.Axes))
+	for {
+		var doc any
+		if err := json.Unmarshal(base, &doc); err != nil {
+			return sweep, nil, fmt.Errorf("%s: %w", sweep.Scenario, err)
+		}
+		run := sweepRun{values: make([]string, len(sweep.Axes))}
+		for i, a := range sweep.Axes {
+			var v any
+			if err := json.Unmarshal(a.Values[idx[i]], &v); err != nil {
+				return sweep, nil, fmt.Errorf("axes[%d].values[%d]: %w", i, idx[i], err)
+			}
+			if doc, err = setPath(doc, strings.Split(strings.NewReplacer("[", ".", "]", "").Replace(a.Param), "."), v); err != nil {
+				return sweep, nil, fmt.Errorf("axes[%d].param: %s: %w", i, a.Param, err)
+			}
+			run.values[i] = axisValue(a.Values[idx[i]])
+		}
+
+		label := sweepLabel(sweep.Axes, run.values)
+		b, err := json.Marshal(doc)
+		if err != nil {
+			return sweep, nil, err
+		}
+		var s Scenario
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&s); err != nil {
+			return sweep, nil, fmt.Errorf("%s: %w", label, err)
+		}
+		if err := s.resolve(); err != nil {
+			return sweep, nil, fmt.Errorf("%s: %w", label, err)
+		}
+		run.cfg = s.config()
+		runs = append(runs, run)
+
+		// Next combination.
+		i := len(idx) - 1
+		for ; i >= 0; i-- {
+			idx[i]++
+			if idx[i] < len(sweep.Axes[i].Values) {
+				break
+			}
+			idx[i] = 0
+		}
+		if i < 0 {
+			break
+		}
+	}
+
+	return sweep, runs, nil
+}
+
+// relativeTo resolves path relative to the directory of file.
+func relativeTo(file, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(file), path)
+}
+
+// setPath sets value at path in decoded JSON document, missing objects are created.
+func setPath(node any, path []string, v any) (any, error) {
+	if len(path) == 0 {
+		return v, nil
+	}
+
+	switch n := node.(type) {
+	case nil:
+		return setPath(map[string]any{}, path, v)
+	case map[string]any:
+		child, err := setPath(n[path[0]], path[1:], v)
+		if err != nil {
+			return nil, err
+		}
+		n[path[0]] = child
+		return n, nil
+	case []any:
+		i, err := strconv.Atoi(path[0])
+		if err != nil || i < 0 || i >= len(n) {
+			return nil, fmt.Errorf("no element %s in array of %d", path[0], len(n))
+		}
+		child, err := setPath(n[i], path[1:], v)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = child
+		return n, nil
+	}
+
+	return nil, fmt.Errorf("can't set %s of a scalar value", path[0])
+}
+
+// axisValue formats axis value for labels, strings are shown without quotes.
+func axisValue(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var b bytes.Buffer
+	if json.Compact(&b, raw) != nil {
+		return string(raw)
+	}
+	return b.String()
+}
+
+func sweepLabel(axes []sweepAxis, values []string) string {
+	parts := make([]string, len(axes))
+	for i, a := range axes {
+		parts[i] = a.Param + "=" + values[i]
+	}
+	return strings.Join(parts, " ")
+}
+
+// resetTopics empties all topics of the run.
+func resetTopics(ctx context.Context, cfg Config) error {
+	cl, err := NewClient(cfg, "")
+	if err != nil {
+		return err
+	}
+	defer cl.Close()
+	r, ok := cl.(brokers.TopicResetter)
+	if !ok {
+		return fmt.Errorf("%s driver can't reset topics", cfg.Driver)
+	}
+	var topics []string
+	for _, g := range cfg.Groups {
+		topics = append(topics, g.Topics...)
+	}
+
+	return r.ResetTopics(ctx, topics)
+}
+
+// writeSweepTable writes markdown table with a row per run.
+func writeSweepTable(w io.Writer, axes []sweepAxis, runs []sweepRun) {
+	fmt.Fprint(w, "|")
+	for _, a := range axes {
+		fmt.Fprintf(w, " %s |", a.Param)
+	}
+	fmt.Fprintln(w, " Messages/sec | MiB/sec | P50 ms | P90 ms | P99 ms | P99.9 ms | Max ms | Missing |")
+	fmt.Fprint(w, "|")
+	for range axes {
+		fmt.Fprint(w, " --- |")
+	}
+	fmt.Fprintln(w, " ---: | ---: | ---: | ---: | ---: | ---: | ---: | ---: |")
+
+	for _, run := range runs {
+		fmt.Fprint(w, "|")
+		for _, v := range run.values {
+			fmt.Fprintf(w, " %s |", v)
+		}
+		res := run.result
+		h := res.Latencies.Latency
+		fmt.Fprintf(w, " %.2f | %.2f | %s | %s | %s | %s | %s | %d |\n", res.Throughput, res.DataThroughput,
+			msf(h.Quantile(0.5)), msf(h.Quantile(0.9)), msf(h.Quantile(0.99)), msf(h.Quantile(0.999)), msf(h.Max()), res.Errors.Missing)
+	}
+}
+
+// msf formats duration as fractional milliseconds.
+func msf(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 2, 64)
+}
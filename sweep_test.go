@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSetPath(t *testing.T) {
+	doc := func() any {
+		var v any
+		if err := json.Unmarshal([]byte(`{"driver": "kafka", "groups": [{"rate": 1}, {"rate": 2}]}`), &v); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	for _, tt := range []struct {
+		path string
+		v    any
+		want string // Document after the change, empty if it fails.
+	}{
+		{"driver", "redpanda", `{"driver":"redpanda","groups":[{"rate":1},{"rate":2}]}`},
+		{"groups.1.rate", 5.0, `{"driver":"kafka","groups":[{"rate":1},{"rate":5}]}`},
+		{"options.acks", "all", `{"driver":"kafka","groups":[{"rate":1},{"rate":2}],"options":{"acks":"all"}}`},
+		{"groups.0.payload.seed", 3.0, `{"driver":"kafka","groups":[{"payload":{"seed":3},"rate":1},{"rate":2}]}`},
+		{"groups.2.rate", 5.0, ""},
+		{"groups.x.rate", 5.0, ""},
+		{"driver.name", "kafka", ""},
+	} {
+		got, err := setPath(doc(), strings.Split(tt.path, "."), tt.v)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%s: set, want error", tt.path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.path, err)
+			continue
+		}
+		if b, _ := json.Marshal(got); string(b) != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.path, b, tt.want)
+		}
+	}
+}
+
+func TestLoadSweep(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	write("base.json", `{"driver": "kafka", "brokers": ["localhost:9092"], "duration": "1m",
+  "groups": [{"topics": ["t0"], "rate": 100, "size": "fixed:1024"}]}`)
+	path := write("sweep.json", `{"scenario": "base.json", "axes": [
+  {"param": "groups[0].producers", "values": [1, 2, 4]},
+  {"param": "options.compression", "values": ["none", "zstd"]}]}`)
+
+	_, runs, err := loadSweep(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The last axis changes fastest.
+	want := [][]string{{"1", "none"}, {"1", "zstd"}, {"2", "none"}, {"2", "zstd"}, {"4", "none"}, {"4", "zstd"}}
+	var got [][]string
+	for _, run := range runs {
+		got = append(got, run.values)
+		producers, compression := run.cfg.Groups[0].Producers, run.cfg.Options.Compression
+		if strconv.Itoa(producers) != run.values[0] || compression != run.values[1] {
+			t.Errorf("run %v: %d producers, %s compression", run.values, producers, compression)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got runs %v, want %v", got, want)
+	}
+	if label := sweepLabel([]sweepAxis{{Param: "groups[0].producers"}, {Param: "options.compression"}}, got[1]); label != "groups[0].producers=1 options.compression=zstd" {
+		t.Errorf("label %q", label)
+	}
+
+	for _, tt := range []struct {
+		name, sweep, err string
+	}{
+		{"no scenario", `{"axes": [{"param": "driver", "values": ["kafka"]}]}`, "scenario:"},
+		{"no axes", `{"scenario": "base.json"}`, "axes:"},
+		{"no values", `{"scenario": "base.json", "axes": [{"param": "driver"}]}`, "axes[0].values:"},
+		{"axis twice", `{"scenario": "base.json", "axes": [{"param": "driver", "values": ["kafka"]}, {"param": "driver", "values": ["nats"]}]}`, "axes[1].param:"},
+		{"no such element", `{"scenario": "base.json", "axes": [{"param": "groups[1].rate", "values": [1]}]}`, "axes[0].param:"},
+		{"invalid combination", `{"scenario": "base.json", "axes": [{"param": "driver", "values": ["kafka", "kinesis"]}]}`, "driver=kinesis: driver:"},
+		{"unknown field", `{"scenario": "base.json", "axes": [{"param": "groups[0].burst", "values": [1]}]}`, `groups[0].burst=1: json: unknown field "burst"`},
+	} {
+		_, _, err := loadSweep(write(tt.name+".json", tt.sweep))
+		if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+			t.Errorf("%s: got %v, want %s error", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestAxisValue(t *testing.T) {
+	for raw, want := range map[string]string{
+		`"zstd"`:             "zstd",
+		`4`:                  "4",
+		`{ "acks" : "all" }`: `{"acks":"all"}`,
+		`[1, 2]`:             "[1,2]",
+		`true`:               "true",
+	} {
+		if got := axisValue(json.RawMessage(raw)); got != want {
+			t.Errorf("axisValue(%s) = %s, want %s", raw, got, want)
+		}
+	}
+}
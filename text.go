@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// printResult renders result document as text report.
+func printResult(w io.Writer, res Result) {
+	s := res.Scenario
+	if res.Role != roleProduce && res.Consumed == 0 {
+		fmt.Fprintf(w, "No messages received in %v\n", time.Duration(res.Elapsed))
+		printAudit(w, res.Topics)
+		printAssertions(w, res.Assertions)
+		return
+	}
+
+	fmt.Fprintf(w, "Driver: %s (%v)\n", s.Driver, s.Options.resolve(s.Driver))
+	fmt.Fprintf(w, "Payload: %s\n", res.Payload)
+	if res.Role != roleBoth {
+		fmt.Fprintf(w, "Role: %s\n", res.Role)
+	}
+	openLoop := false
+	for _, g := range s.Groups {
+		fmt.Fprintf(w, "Group %s: topics %s, %d producers and %d consumers per topic, %d messages/sec per producer (%s schedule), message size %s",
+			g.Name, strings.Join(g.Topics, ","), g.Producers, g.Consumers, g.Rate, g.Schedule, g.Size)
+		if g.Keys != "none" {
+			fmt.Fprintf(w, ", keys %s", g.Keys)
+		}
+		fmt.Fprintln(w)
+		openLoop = openLoop || g.Schedule != scheduleClosed
+	}
+	if res.Role != roleConsume {
+		fmt.Fprintf(w, "Produce throughput: %.2f messages/sec\n", res.ProduceThroughput)
+	}
+	fmt.Fprintf(w, "Message throughput: %.2f messages/sec\n", res.Throughput)
+	if t := res.MeasuredThroughput; t != nil {
+		fmt.Fprintf(w, "Measurement window throughput: %.2f messages/sec (%.0f%% CI %.2f - %.2f, %d intervals)\n",
+			t.Mean, 100*confidence, t.CI.Low, t.CI.High, t.Intervals)
+	}
+	fmt.Fprintf(w, "Data throughput: %f Mb/sec\n", res.DataThroughput)
+	if res.ApproxThroughput {
+		fmt.Fprintln(w, "Throughput is approximate: sum of host rates, results have no time series to count the common time window")
+	}
+
+	printLatencies(w, "", res.Percentiles.Latency)
+	printLatencies(w, "Ack", res.Percentiles.Ack)
+	printSizeLatencies(w, res.Sizes)
+	printTopics(w, res.Topics)
+	printPartitions(w, res.Topics)
+	printBrokerTimestamps(w, res)
+	if openLoop {
+		printLatencies(w, "Corrected", res.Percentiles.Corrected)
+		printScheduleLag(w, res)
+	}
+	fmt.Fprintf(w, "Total elapsed time: %v\n", time.Duration(res.Elapsed))
+	printWindow(w, res.Window)
+	printSeries(w, res.Series)
+	fmt.Fprintf(w, "Commandline arguments: %s\n", strings.Join(res.Environment.Args, " "))
+	if b, err := json.Marshal(s); err == nil {
+		fmt.Fprintf(w, "Scenario: %s\n", b)
+	}
+	if len(res.Hosts) > 0 {
+		printHosts(w, res)
+	} else {
+		fmt.Fprintf(w, "Run ID: %s\n", res.RunID)
+	}
+	if c := res.Clock; c != nil {
+		fmt.Fprintf(w, "Clock offset: %v ± %v before run, %v ± %v after, timestamps error bound %v\n",
+			time.Duration(c.Before.Offset), time.Duration(c.Before.Uncertainty), time.Duration(c.After.Offset),
+			time.Duration(c.After.Uncertainty), time.Duration(c.ErrorBound))
+	}
+	printProducers(w, res)
+	printAudit(w, res.Topics)
+	printAssertions(w, res.Assertions)
+}
+
+// printAssertions prints a pass/fail row per assertion.
+func printAssertions(out io.Writer, results []AssertionResult) {
+	if len(results) == 0 {
+		return
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Assertion\tActual\tLimit\tResult\t")
+	failed := 0
+	for _, r := range results {
+		status := "PASS"
+		if !r.Passed {
+			status = "FAIL"
+			failed++
+		}
+		if r.Error != "" {
+			fmt.Fprintf(w, "%s\t-\t-\t%s: %s\t\n", r.Assertion, status, r.Error)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", r.Assertion, metricText(r.Actual, r.Unit), metricText(r.Limit, r.Unit), status)
+	}
+	w.Flush()
+	if failed > 0 {
+		fmt.Fprintf(out, "%d of %d assertions failed\n", failed, len(results))
+	} else {
+		fmt.Fprintf(out, "All %d assertions passed\n", len(results))
+	}
+}
+
+// metricText formats value of assertion metric.
+func metricText(v float64, unit string) string {
+	switch unit {
+	case "ms":
+		return fmt.Sprintf("%.3f ms", v)
+	case "ratio":
+		return fmt.Sprintf("%.3f%%", 100*v)
+	case "msg/s", "MiB/s":
+		return fmt.Sprintf("%.2f %s", v, unit)
+	}
+	return fmt.Sprintf("%.0f %s", v, unit)
+}
+
+// printHosts prints a row per result merged into res.
+func printHosts(out io.Writer, res Result) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Host\tRole\tRun ID\tStart\tElapsed\tProduced\tConsumed\tMessages/sec\tP50\tP99\tMax\tMissing\t")
+	for _, h := range res.Hosts {
+		p := h.Percentiles.Latency
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%v\t%d\t%d\t%.2f\t%s\t%s\t%s\t%d\t\n", h.Name, h.Role, h.RunID,
+			h.Start.Format("15:04:05.000"), time.Duration(h.Elapsed).Round(time.Millisecond), h.Produced, h.Consumed,
+			h.Throughput, ms(p.P50), ms(p.P99), ms(p.Max), h.Errors.Missing)
+	}
+	w.Flush()
+}
+
+// printLatencies prints latency percentiles, kind is a qualifier like "Ack" (empty for end-to-end latency).
+func printLatencies(w io.Writer, kind string, p Percentiles) {
+	prefix, label := "", "Latency"
+	if kind != "" {
+		prefix, label = strings.ToLower(kind)+" ", kind+" latency"
+	}
+	if p.Count == 0 {
+		fmt.Fprintf(w, "No %slatency samples in measurement window\n", prefix)
+		return
+	}
+
+	var ci PercentileCI
+	if p.CI != nil {
+		ci = *p.CI
+	}
+	fmt.Fprintf(w, "Min %slatency: %v\n", prefix, ms(p.Min))
+	fmt.Fprintf(w, "P50 %slatency: %v%s\n", prefix, ms(p.P50), ciText(ci.P50))
+	fmt.Fprintf(w, "P90 %slatency: %v%s\n", prefix, ms(p.P90), ciText(ci.P90))
+	fmt.Fprintf(w, "P99 %slatency: %v%s\n", prefix, ms(p.P99), ciText(ci.P99))
+	fmt.Fprintf(w, "P99.9 %slatency: %v%s\n", prefix, ms(p.P999), ciText(ci.P999))
+	fmt.Fprintf(w, "Max %slatency: %v\n", prefix, ms(p.Max))
+	fmt.Fprintf(w, "%s StdDev: %.6f\n", label, p.StdDev)
+	fmt.Fprintf(w, "%s StdErr: %.6f\n", label, p.StdErr)
+}
+
+// printTopics prints throughput, latency, errors and producer fairness per topic.
+func printTopics(out io.Writer, topics []TopicSummary) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Topic\tGroup\tMessages/sec\tMb/sec\tP50\tP99\tMax\tMissing\tDuplicated\tJain's index\tSpread\t")
+	for _, t := range topics {
+		jain, spread := "-", "-"
+		if t.Fairness != nil {
+			jain, spread = fmt.Sprintf("%.3f", t.Fairness.Jain), fmt.Sprintf("%.1f%%", 100*t.Fairness.Spread)
+		}
+		p := t.Percentiles.Latency
+		fmt.Fprintf(w, "%s\t%s\t%.2f\t%.2f\t%s\t%s\t%s\t%d\t%d\t%s\t%s\t\n", t.Topic, t.Group, t.Throughput, t.DataThroughput,
+			ms(p.P50), ms(p.P99), ms(p.Max), t.Missing, t.Duplicated, jain, spread)
+	}
+	w.Flush()
+}
+
+// printProducers prints throughput, latency, gaps, duplicates and out-of-order
+// deliveries per topic and producer.
+func printProducers(out io.Writer, res Result) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Topic\tProducer\tAcked\tMessages/sec\tReceived\tDelivered/sec\tP50\tP99\tMax\tMissing\tGaps\tDuplicates\tOut-of-order\t")
+	for _, t := range res.Topics {
+		for _, p := range t.Producers {
+			l := p.Percentiles.Latency
+			fmt.Fprintf(w, "%s\t%s\t%d\t%.2f\t%d\t%.2f\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t\n", t.Topic, producerLabel(res, p), p.Acked, p.Throughput, p.Received, p.Delivered,
+				ms(l.P50), ms(l.P99), ms(l.Max), p.Missing, p.Gaps, p.Duplicates, p.Reordered)
+		}
+	}
+	w.Flush()
+}
+
+// printSizeLatencies prints latency percentiles per message size bucket.
+func printSizeLatencies(out io.Writer, sizes []SizeSummary) {
+	if len(sizes) < 2 {
+		return
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Message size\tCount\tP50\tP90\tP99\tMax\t")
+	for _, s := range sizes {
+		p := s.Latency
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t\n", s.Bucket, p.Count, ms(p.P50), ms(p.P90), ms(p.P99), ms(p.Max))
+	}
+	w.Flush()
+}
+
+// printPartitions prints message counts and latency per partition of topics
+// consumed from more than one partition.
+func printPartitions(out io.Writer, topics []TopicSummary) {
+	for _, t := range topics {
+		if len(t.Partitions) < 2 {
+			continue
+		}
+		total, hottest := uint64(0), uint64(0)
+		for _, ps := range t.Partitions {
+			total += ps.Received
+			if ps.Received > hottest {
+				hottest = ps.Received
+			}
+		}
+
+		fmt.Fprintf(out, "Topic %s partitions: %d, hottest partition has %.2fx mean load\n",
+			t.Topic, len(t.Partitions), float64(hottest)*float64(len(t.Partitions))/float64(total))
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "Partition\tMessages\tShare\tP50\tP99\tMax\t")
+		for _, ps := range t.Partitions {
+			fmt.Fprintf(w, "%d\t%d\t%.1f%%\t%s\t%s\t%s\t\n", ps.Partition, ps.Received, 100*float64(ps.Received)/float64(total),
+				ms(ps.Latency.P50), ms(ps.Latency.P99), ms(ps.Latency.Max))
+		}
+		w.Flush()
+	}
+}
+
+// printBrokerTimestamps prints producer to broker (append) and broker to consumer (delivery)
+// latency split for topics with broker set timestamps.
+func printBrokerTimestamps(w io.Writer, res Result) {
+	for _, t := range res.Topics {
+		fmt.Fprintf(w, "Topic %s broker timestamps: %s\n", t.Topic, t.TimestampType)
+	}
+	if res.Percentiles.Append.Count == 0 {
+		fmt.Fprintln(w, "No broker append timestamps, latency breakdown is not available (topics must use LogAppendTime)")
+		return
+	}
+
+	printLatencies(w, "Append", res.Percentiles.Append)
+	printLatencies(w, "Delivery", res.Percentiles.Delivery)
+}
+
+// printScheduleLag reports how far behind the open loop schedule each producer fell.
+func printScheduleLag(w io.Writer, res Result) {
+	if res.Role == roleConsume {
+		return // Known to producers only.
+	}
+	for _, t := range res.Topics {
+		for _, p := range t.Producers {
+			fmt.Fprintf(w, "Topic %s producer %s: max schedule lag %v, final schedule lag %v\n",
+				t.Topic, producerLabel(res, p), time.Duration(p.MaxLag).Round(time.Microsecond), time.Duration(p.Lag).Round(time.Microsecond))
+		}
+	}
+}
+
+// printWindow tells which messages latency is measured for.
+func printWindow(w io.Writer, win MeasureWindow) {
+	fmt.Fprintf(w, "Measurement window: %s", windowText(win))
+	switch {
+	case win.Mode != windowSteady:
+		fmt.Fprintln(w)
+	case win.SteadyAt == 0:
+		fmt.Fprintln(w, ", steady state was not reached")
+	default:
+		fmt.Fprintf(w, ", reached after %v\n", time.Duration(win.SteadyAt).Round(time.Millisecond))
+	}
+}
+
+// windowText describes measurement window, without steady state detection result.
+func windowText(win MeasureWindow) string {
+	switch win.Mode {
+	case windowFixed:
+		return fmt.Sprintf("%v warmup and %v cooldown excluded", time.Duration(win.Warmup), time.Duration(win.Cooldown))
+	case windowSteady:
+		return fmt.Sprintf("steady state (throughput and P50 latency within %.0f%% over %v) after %v warmup, %v cooldown excluded",
+			100*win.Steady.Tolerance, time.Duration(win.Steady.Window), time.Duration(win.Warmup), time.Duration(win.Cooldown))
+	}
+	return "first and last 10% of the run excluded"
+}
+
+// printSeries prints time series phases and the slowest measured interval,
+// the series itself goes to CSV.
+func printSeries(w io.Writer, s *Series) {
+	if s == nil {
+		return
+	}
+	fmt.Fprintf(w, "Time series: %d intervals of %v, measurement window %v - %v, drain from %v\n", len(s.Points), time.Duration(s.Interval),
+		time.Duration(s.MeasureStart).Round(time.Millisecond), time.Duration(s.MeasureEnd).Round(time.Millisecond), time.Duration(s.DrainStart).Round(time.Millisecond))
+	var slowest *SeriesPoint
+	for i, p := range s.Points {
+		if p.Phase == phaseMeasure && (slowest == nil || p.Throughput < slowest.Throughput) {
+			slowest = &s.Points[i]
+		}
+	}
+	if slowest != nil {
+		fmt.Fprintf(w, "Slowest measured interval at %v: %.2f messages/sec, P99 latency %v\n",
+			time.Duration(slowest.Start), slowest.Throughput, ms(slowest.Latency.P99))
+	}
+}
+
+// producerLabel returns producer id, prefixed with run id for producers of other processes.
+func producerLabel(res Result, p ProducerSummary) string {
+	if p.RunID == res.RunID {
+		return fmt.Sprint(p.ID)
+	}
+	return fmt.Sprintf("%s/%d", p.RunID, p.ID)
+}
+
+// ciText formats latency confidence interval to follow a percentile,
+// empty if it is not known.
+func ciText(ci ConfidenceInterval) string {
+	if ci == (ConfidenceInterval{}) {
+		return ""
+	}
+	return fmt.Sprintf(" (%.0f%% CI %.3f - %.3f ms)", 100*confidence, ci.Low, ci.High)
+}
+
+// ms formats milliseconds value the way text report shows latencies.
+func ms(v float64) string {
+	return fmt.Sprintf("%d ms.", int64(v))
+}